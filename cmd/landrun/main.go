@@ -1,21 +1,38 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	osexec "os/exec"
+	"sort"
 	"strings"
 
 	"github.com/urfave/cli/v2"
+	"github.com/zouuup/landrun/internal/doctor"
 	"github.com/zouuup/landrun/internal/elfdeps"
+	"github.com/zouuup/landrun/internal/env"
 	"github.com/zouuup/landrun/internal/exec"
+	"github.com/zouuup/landrun/internal/learn"
 	"github.com/zouuup/landrun/internal/log"
+	"github.com/zouuup/landrun/internal/pathvars"
+	"github.com/zouuup/landrun/internal/preset"
+	"github.com/zouuup/landrun/internal/profile"
+	"github.com/zouuup/landrun/internal/report"
+	"github.com/zouuup/landrun/internal/rlimit"
 	"github.com/zouuup/landrun/internal/sandbox"
+	"github.com/zouuup/landrun/internal/seccomp"
 )
 
 // Version is the current version of landrun
 const Version = "0.1.15"
 
 func main() {
+	// landrun re-executes itself to start supervised commands.
+	if len(os.Args) > 1 && os.Args[1] == exec.HelperArg {
+		exec.RunHelper()
+	}
+
 	app := &cli.App{
 		Name:    "landrun",
 		Usage:   "Run a command in a Landlock sandbox",
@@ -23,10 +40,35 @@ func main() {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "log-level",
-				Usage:   "Set logging level (error, info, debug)",
-				Value:   "error",
+				Usage:   "Set logging level (error, warn, info, debug, trace)",
+				Value:   "warn",
 				EnvVars: []string{"LANDRUN_LOG_LEVEL"},
 			},
+			&cli.StringFlag{
+				Name:    "log-format",
+				Usage:   "Set the format of log messages (text, json)",
+				Value:   "text",
+				EnvVars: []string{"LANDRUN_LOG_FORMAT"},
+			},
+			&cli.StringFlag{
+				Name:    "log-file",
+				Usage:   "Append log messages to a file instead of writing them to stderr",
+				EnvVars: []string{"LANDRUN_LOG_FILE"},
+			},
+			&cli.BoolFlag{
+				Name:  "log-syslog",
+				Usage: "Also send log messages to the local syslog daemon or journald",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "Load sandbox options from a profile file (TOML, YAML or JSON); other flags are merged on top",
+				EnvVars: []string{"LANDRUN_PROFILE"},
+			},
+			&cli.StringSliceFlag{
+				Name:  "preset",
+				Usage: "Apply a built-in preset (see 'landrun presets list')",
+			},
 			&cli.StringSliceFlag{
 				Name:  "ro",
 				Usage: "Allow read-only access to this path",
@@ -43,16 +85,51 @@ func main() {
 				Name:  "rwx",
 				Usage: "Allow read-write access with execution to this path",
 			},
-			&cli.IntSliceFlag{
+			&cli.GenericFlag{
+				Name:  "path",
+				Usage: "Allow specific access rights to a path, as PATH:RIGHTS with comma separated Landlock rights (e.g. /var/spool/x:read,write,make_reg)",
+				Value: &customPathFlag{},
+			},
+			&cli.StringSliceFlag{
+				Name:  "rw-create",
+				Usage: "Like --rw, but create the path first if it doesn't exist (PATH[:MODE], a trailing / creates a directory)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "rwx-create",
+				Usage: "Like --rwx, but create the path first if it doesn't exist (PATH[:MODE], a trailing / creates a directory)",
+			},
+			&cli.StringFlag{
+				Name:  "missing-paths",
+				Usage: "What to do with paths that don't exist: error, warn or skip (paths prefixed with ? are always skipped)",
+				Value: sandbox.MissingError,
+			},
+			&cli.StringSliceFlag{
+				Name:  "deny",
+				Usage: "Deny access to this path even if a parent directory is allowed",
+			},
+			&cli.StringSliceFlag{
 				Name:   "bind-tcp",
-				Usage:  "Allow binding to these TCP ports",
+				Usage:  "Allow binding to these TCP ports (numbers, ranges like 8000-8099 or service names)",
 				Hidden: false,
 			},
-			&cli.IntSliceFlag{
+			&cli.StringSliceFlag{
 				Name:   "connect-tcp",
-				Usage:  "Allow connecting to these TCP ports",
+				Usage:  "Allow connecting to these TCP ports (numbers, ranges like 8000-8099 or service names)",
 				Hidden: false,
 			},
+			&cli.StringSliceFlag{
+				Name:  "allow-socket-family",
+				Usage: "Only allow creating sockets of these address families (such as unix, inet, inet6)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "deny-socket-family",
+				Usage: "Deny creating sockets of these address families (such as inet6, netlink, packet)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-udp",
+				Usage: "Deny creating UDP sockets",
+				Value: false,
+			},
 			&cli.BoolFlag{
 				Name:  "best-effort",
 				Usage: "Use best effort mode (fall back to less restrictive sandbox if necessary)",
@@ -60,9 +137,35 @@ func main() {
 			},
 			&cli.StringSliceFlag{
 				Name:  "env",
-				Usage: "Environment variables to pass to the sandboxed command (KEY=VALUE or just KEY to pass current value)",
+				Usage: "Environment variables to pass to the sandboxed command (KEY=VALUE, with $NAME references expanded, or just KEY to pass current value)",
 				Value: cli.NewStringSlice(),
 			},
+			&cli.StringSliceFlag{
+				Name:  "env-file",
+				Usage: "Load environment variables for the sandboxed command from a dotenv file",
+			},
+			&cli.StringSliceFlag{
+				Name:  "env-pattern",
+				Usage: "Pass the environment variables matching a glob pattern (such as 'LC_*')",
+			},
+			&cli.BoolFlag{
+				Name:  "inherit-env",
+				Usage: "Pass the whole environment to the sandboxed command",
+				Value: false,
+			},
+			&cli.StringSliceFlag{
+				Name:  "unset-env",
+				Usage: "Don't pass the inherited environment variables matching a glob pattern (such as 'AWS_*')",
+			},
+			&cli.StringFlag{
+				Name:  "env-preset",
+				Usage: "Pass a preset set of environment variables (minimal: PATH, HOME, LANG, TERM, TZ)",
+			},
+			&cli.BoolFlag{
+				Name:  "env-strict",
+				Usage: "Fail on unset --env variables and undefined references in values instead of warning",
+				Value: false,
+			},
 			&cli.BoolFlag{
 				Name:  "unrestricted-filesystem",
 				Usage: "Allow unrestricted filesystem access",
@@ -73,9 +176,24 @@ func main() {
 				Usage: "Allow unrestricted network access",
 				Value: false,
 			},
+			&cli.BoolFlag{
+				Name:  "scope-abstract-unix",
+				Usage: "Block connecting to abstract unix sockets created outside the sandbox (Landlock ABI 6)",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "scope-signal",
+				Usage: "Block sending signals to processes outside the sandbox (Landlock ABI 6)",
+				Value: false,
+			},
 			&cli.BoolFlag{
 				Name:  "ldd",
-				Usage: "Automatically detect and add library dependencies to --rox",
+				Usage: "Automatically detect and add library dependencies, recursively, to --rox, with the libraries declared in .note.dlopen sections",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "ldd-heuristics",
+				Usage: "With --ldd, also add libraries whose names appear as strings in the binary, which it may load with dlopen",
 				Value: false,
 			},
 			&cli.BoolFlag{
@@ -83,69 +201,411 @@ func main() {
 				Usage: "Automatically add the executable path to --rox",
 				Value: false,
 			},
+			&cli.BoolFlag{
+				Name:  "fail-empty-glob",
+				Usage: "Fail if a glob pattern in a path matches nothing instead of skipping it",
+				Value: false,
+			},
+			&cli.StringSliceFlag{
+				Name:  "var",
+				Usage: "Define a variable for use in paths as $NAME or ${NAME} (NAME=VALUE)",
+			},
+			&cli.BoolFlag{
+				Name:  "strict-vars",
+				Usage: "Fail on undefined variables in paths instead of expanding them to an empty string",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "seccomp",
+				Usage: "Filter syscalls with seccomp: default (deny a built-in list of dangerous syscalls), deny (deny --seccomp-deny) or allow (deny all but --seccomp-allow)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "seccomp-deny",
+				Usage: "Deny this syscall (with --seccomp default or deny)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "seccomp-allow",
+				Usage: "Allow this syscall (with --seccomp default or allow)",
+			},
+			&cli.StringFlag{
+				Name:  "seccomp-action",
+				Usage: "What happens on a denied syscall: errno (fail with EPERM) or kill (kill the process with SIGSYS)",
+				Value: seccomp.ActionErrno,
+			},
+			&cli.StringFlag{
+				Name:  "seccomp-profile",
+				Usage: "Also filter syscalls with this Docker/OCI seccomp profile (JSON)",
+			},
+			&cli.StringFlag{
+				Name:  "limit-as",
+				Usage: "Limit the address space of the command (size such as 512M or 2G)",
+			},
+			&cli.StringFlag{
+				Name:  "limit-cpu",
+				Usage: "Limit the CPU time of the command (seconds or a duration such as 30s or 5m)",
+			},
+			&cli.StringFlag{
+				Name:  "limit-nofile",
+				Usage: "Limit the number of files the command can open",
+			},
+			&cli.StringFlag{
+				Name:  "limit-nproc",
+				Usage: "Limit the number of processes of the user the command runs as",
+			},
+			&cli.StringFlag{
+				Name:  "limit-fsize",
+				Usage: "Limit the size of files the command writes (size such as 100M)",
+			},
+			&cli.StringFlag{
+				Name:  "limit-core",
+				Usage: "Limit the size of core dumps of the command (size, 0 disables them)",
+			},
+			&cli.StringFlag{
+				Name:  "limit-stack",
+				Usage: "Limit the stack size of the command (size such as 8M)",
+			},
+			&cli.BoolFlag{
+				Name:  "supervise",
+				Usage: "Run the command as a child of landrun instead of replacing landrun with it, forwarding signals and exiting with the command's status",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "on-exit",
+				Usage: "Shell command to run outside the sandbox after the supervised command exits (requires --supervise)",
+			},
+			&cli.StringFlag{
+				Name:  "report",
+				Usage: "Write a JSON report of how the command was sandboxed and how it ended to a file (requires --supervise)",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the rules that would be applied and exit without running the command",
+				Value: false,
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "doctor",
+				Usage: "Report the Landlock support of this host and how it affects landrun",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the report as JSON",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					report := doctor.Probe()
+					if c.Bool("json") {
+						enc := json.NewEncoder(os.Stdout)
+						enc.SetIndent("", "  ")
+						if err := enc.Encode(report); err != nil {
+							return err
+						}
+					} else {
+						report.WriteText(os.Stdout)
+					}
+					if !report.Usable() {
+						os.Exit(1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "learn",
+				Usage:     "Trace a command and write a profile with the paths and ports it used",
+				ArgsUsage: "-- COMMAND [ARGS...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Write the profile to this file (.toml, .yaml, .yml or .json)",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "collapse",
+						Usage: "Grant a whole directory once this many files in it are used with the same access (0 disables)",
+						Value: 3,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					args := c.Args().Slice()
+					if len(args) == 0 {
+						log.Fatal("Missing command to run")
+					}
+					output := c.String("output")
+
+					log.Info("Learning: %v", args)
+					obs, err := learn.Trace(args, os.Environ())
+					if err != nil {
+						log.Fatal("Failed to trace command: %v", err)
+					}
+
+					prof := obs.Profile(c.Int("collapse"))
+					prof.Description = "Generated by landrun learn for: " + strings.Join(args, " ")
+					data, err := prof.Encode(output)
+					if err != nil {
+						log.Fatal("Failed to encode profile: %v", err)
+					}
+					if err := os.WriteFile(output, data, 0644); err != nil {
+						log.Fatal("Failed to write profile: %v", err)
+					}
+					fmt.Fprintf(os.Stderr, "landrun: wrote %s (%d paths, %d ports)\n", output,
+						len(prof.ReadOnlyPaths)+len(prof.ReadOnlyExecutablePaths)+len(prof.ReadWritePaths)+len(prof.ReadWriteExecutablePaths),
+						len(prof.BindTCPPorts)+len(prof.ConnectTCPPorts))
+					os.Exit(obs.ExitCode)
+					return nil
+				},
+			},
+			{
+				Name:  "presets",
+				Usage: "Inspect the built-in presets",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "List the built-in presets",
+						Action: func(c *cli.Context) error {
+							for _, name := range preset.Names() {
+								p, err := preset.Get(name)
+								if err != nil {
+									return err
+								}
+								fmt.Printf("%-14s %s\n", name, p.Description)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "show",
+						Usage:     "Show what a preset grants",
+						ArgsUsage: "NAME...",
+						Action: func(c *cli.Context) error {
+							if c.NArg() == 0 {
+								return fmt.Errorf("missing preset name")
+							}
+							for _, name := range c.Args().Slice() {
+								p, err := preset.Get(name)
+								if err != nil {
+									return err
+								}
+								printPreset(name, p)
+							}
+							return nil
+						},
+					},
+				},
+			},
 		},
 		Before: func(c *cli.Context) error {
-			log.SetLevel(c.String("log-level"))
-			return nil
+			return log.Configure(log.Options{
+				Level:  c.String("log-level"),
+				Format: c.String("log-format"),
+				File:   c.String("log-file"),
+				Syslog: c.Bool("log-syslog"),
+			})
 		},
 		Action: func(c *cli.Context) error {
 			args := c.Args().Slice()
-			if len(args) == 0 {
+			dryRun := c.Bool("dry-run")
+			if len(args) == 0 && !dryRun {
 				log.Fatal("Missing command to run")
 			}
+			supervise := c.Bool("supervise")
+			if c.IsSet("on-exit") && !supervise {
+				log.Fatal("--on-exit requires --supervise")
+			}
+			if c.IsSet("report") && !supervise {
+				log.Fatal("--report requires --supervise")
+			}
 
-			// Combine --ro and --rox paths for read-only access
-			readOnlyPaths := append([]string{}, c.StringSlice("ro")...)
-			readOnlyPaths = append(readOnlyPaths, c.StringSlice("rox")...)
+			prof := &profile.Profile{}
+			if path := c.String("profile"); path != "" {
+				loaded, err := profile.Load(path)
+				if err != nil {
+					log.Fatal("Failed to load profile: %v", err)
+				}
+				log.Debug("Loaded profile %s", path)
+				loaded.Attribute(func(key string) string { return fmt.Sprintf("profile %s (%s)", path, key) })
+				prof.Merge(loaded)
+			}
+			flags, err := flagProfile(c)
+			if err != nil {
+				log.Fatal("%v", err)
+			}
+			prof.Merge(flags)
 
-			// Combine --rw and --rwx paths for read-write access
-			readWritePaths := append([]string{}, c.StringSlice("rw")...)
-			readWritePaths = append(readWritePaths, c.StringSlice("rwx")...)
+			prof, err = preset.Resolve(prof)
+			if err != nil {
+				log.Fatal("Failed to apply presets: %v", err)
+			}
 
-			// Combine --rox and --rwx paths for executable permissions
-			readOnlyExecutablePaths := append([]string{}, c.StringSlice("rox")...)
-			readWriteExecutablePaths := append([]string{}, c.StringSlice("rwx")...)
+			cfg := prof.SandboxConfig()
 
-			binary, err := osexec.LookPath(args[0])
+			// The binary is only needed for --add-exec and --ldd when
+			// printing the rules without a command.
+			binary := ""
+			if len(args) > 0 {
+				binary, err = osexec.LookPath(args[0])
+				if err != nil {
+					log.Fatal("Failed to find binary: %v", err)
+				}
+			}
+
+			// Expand variables and ~ in paths. The built-in variables
+			// take precedence over profile and --var definitions.
+			vars := map[string]string{}
+			for name, value := range prof.Vars {
+				vars[name] = value
+			}
+			for name, value := range pathvars.Builtins(binary) {
+				vars[name] = value
+			}
+			expander := &pathvars.Expander{
+				Vars:   vars,
+				Strict: profile.Enabled(prof.StrictVars),
+				Undefined: func(name, path string) {
+					log.Warn("Undefined variable %s in path %s", name, path)
+				},
+			}
+			if err := cfg.MapPaths(expander.Expand); err != nil {
+				log.Fatal("Failed to expand paths: %v", err)
+			}
+
+			envVars, err := env.Build(prof.EnvSpec())
 			if err != nil {
-				log.Fatal("Failed to find binary: %v", err)
+				log.Fatal("Failed to build environment: %v", err)
+			}
+			// #!/usr/bin/env interpreters are looked up in the PATH of the
+			// command, not landrun's.
+			searchPath := elfdeps.DefaultSearchPath
+			for _, kv := range envVars {
+				if strings.HasPrefix(kv, "PATH=") {
+					searchPath = strings.TrimPrefix(kv, "PATH=")
+				}
 			}
 
-			// Add command to readOnlyExecutablePaths
-			if c.Bool("add-exec") {
-				readOnlyExecutablePaths = append(readOnlyExecutablePaths, binary)
-				log.Debug("Added executable path: %v", binary)
+			// Add command to ReadOnlyExecutablePaths, with the
+			// interpreters of scripts
+			if profile.Enabled(prof.AddExec) && binary != "" {
+				interps, err := elfdeps.Interpreters(binary, searchPath)
+				if err != nil {
+					log.Fatal("Failed to detect script interpreters: %v", err)
+				}
+				exePaths := append([]string{binary}, interps...)
+				cfg.ReadOnlyExecutablePaths = append(cfg.ReadOnlyExecutablePaths, exePaths...)
+				for _, path := range exePaths {
+					cfg.AddSource(path, "--add-exec")
+				}
+				log.Debug("Added executable paths: %v", exePaths)
 			}
 
-			// If --ldd flag is set, detect and add library dependencies
-			if c.Bool("ldd") {
-				libPaths, err := elfdeps.GetLibraryDependencies(binary)
+			// If --ldd flag is set, detect and add library dependencies,
+			// following the interpreters of scripts
+			if profile.Enabled(prof.LddHeuristics) && !profile.Enabled(prof.Ldd) {
+				log.Fatal("--ldd-heuristics requires --ldd")
+			}
+			if profile.Enabled(prof.Ldd) && binary != "" {
+				deps, err := elfdeps.GetExecutableDependencies(binary, searchPath, elfdeps.Options{
+					DlopenNotes: true,
+					Heuristics:  profile.Enabled(prof.LddHeuristics),
+				})
 				if err != nil {
 					log.Fatal("Failed to detect library dependencies: %v", err)
 				}
-				// Add library directories to readOnlyExecutablePaths
-				readOnlyExecutablePaths = append(readOnlyExecutablePaths, libPaths...)
+				// Add library directories to ReadOnlyExecutablePaths.
+				// Libraries loaded with dlopen are marked as optional in
+				// the sources.
+				var libPaths []string
+				for _, dep := range deps {
+					libPaths = append(libPaths, dep.Path)
+					source := "--ldd"
+					if dep.Optional() {
+						source = "--ldd (optional, " + dep.Found + ")"
+						log.Debug("Added optional library path: %s (%s)", dep.Path, dep.Found)
+					}
+					cfg.AddSource(dep.Path, source)
+				}
+				cfg.ReadOnlyExecutablePaths = append(cfg.ReadOnlyExecutablePaths, libPaths...)
 				log.Debug("Added library paths: %v", libPaths)
 			}
 
-			cfg := sandbox.Config{
-				ReadOnlyPaths:            readOnlyPaths,
-				ReadWritePaths:           readWritePaths,
-				ReadOnlyExecutablePaths:  readOnlyExecutablePaths,
-				ReadWriteExecutablePaths: readWriteExecutablePaths,
-				BindTCPPorts:             c.IntSlice("bind-tcp"),
-				ConnectTCPPorts:          c.IntSlice("connect-tcp"),
-				BestEffort:               c.Bool("best-effort"),
-				UnrestrictedFilesystem:   c.Bool("unrestricted-filesystem"),
-				UnrestrictedNetwork:      c.Bool("unrestricted-network"),
+			limits := prof.ResourceLimits()
+			if err := rlimit.Validate(limits); err != nil {
+				log.Fatal("Invalid resource limits: %v", err)
+			}
+			policy := prof.SeccompPolicy()
+			policy.Sockets = cfg.SocketFilter()
+			if err := policy.LoadProfile(); err != nil {
+				log.Fatal("Failed to load seccomp profile: %v", err)
+			}
+			if err := policy.Validate(); err != nil {
+				log.Fatal("Invalid seccomp policy: %v", err)
 			}
 
-			// Process environment variables
-			envVars := processEnvironmentVars(c.StringSlice("env"))
+			if dryRun {
+				rs, err := sandbox.Plan(cfg)
+				if err != nil {
+					log.Fatal("Failed to plan sandbox: %v", err)
+				}
+				if len(args) > 0 {
+					fmt.Printf("Command: %s\n", strings.Join(args, " "))
+				}
+				rs.WriteText(os.Stdout)
+				rlimit.WriteText(os.Stdout, limits)
+				policy.WriteText(os.Stdout)
+				env.WriteText(os.Stdout, envVars)
+				return nil
+			}
+
+			if supervise {
+				rs, err := sandbox.Plan(cfg)
+				if err != nil {
+					log.Fatal("Failed to plan sandbox: %v", err)
+				}
+				// Hash the binary before it runs, in case it is replaced.
+				var sum string
+				if c.IsSet("report") {
+					if sum, err = report.Hash(binary); err != nil {
+						log.Fatal("Failed to hash binary: %v", err)
+					}
+				}
+				status, err := exec.Supervise(rs, args, envVars, exec.Options{
+					Path:    binary,
+					Log:     log.Current(),
+					OnExit:  c.String("on-exit"),
+					Limits:  limits,
+					Seccomp: policy,
+				})
+				if err != nil {
+					log.Fatal("Failed to run supervised command: %v", err)
+				}
+				if path := c.String("report"); path != "" {
+					r := report.New(report.Run{
+						Version:      Version,
+						Args:         args,
+						Binary:       binary,
+						BinarySHA256: sum,
+						Env:          envVars,
+						Ruleset:      rs,
+						Limits:       limits,
+						Seccomp:      policy,
+						Status:       status,
+					})
+					if err := r.Write(path); err != nil {
+						log.Error("Failed to write report: %v", err)
+					}
+				}
+				status.Exit()
+			}
 
 			if err := sandbox.Apply(cfg); err != nil {
 				log.Fatal("Failed to apply sandbox: %v", err)
 			}
+			if err := rlimit.Apply(limits); err != nil {
+				log.Fatal("Failed to apply resource limits: %v", err)
+			}
+			if err := seccomp.Install(policy); err != nil {
+				log.Fatal("Failed to install seccomp filter: %v", err)
+			}
 
 			return exec.Run(args, envVars)
 		},
@@ -156,21 +616,256 @@ func main() {
 	}
 }
 
-// processEnvironmentVars processes the env flag values
-func processEnvironmentVars(envFlags []string) []string {
-	result := []string{}
-
-	for _, env := range envFlags {
-		// If the flag is just a key (no = sign), get the value from the current environment
-		if !strings.Contains(env, "=") {
-			if val, exists := os.LookupEnv(env); exists {
-				result = append(result, env+"="+val)
+// flagProfile collects the sandbox options given on the command line. Boolean
+// flags are only recorded when explicitly set so they don't mask values from
+// a profile file.
+func flagProfile(c *cli.Context) (*profile.Profile, error) {
+	p := &profile.Profile{
+		Presets:                  c.StringSlice("preset"),
+		ReadOnlyPaths:            c.StringSlice("ro"),
+		ReadOnlyExecutablePaths:  c.StringSlice("rox"),
+		ReadWritePaths:           c.StringSlice("rw"),
+		ReadWriteExecutablePaths: c.StringSlice("rwx"),
+		DenyPaths:                c.StringSlice("deny"),
+		Env:                      c.StringSlice("env"),
+		EnvFiles:                 c.StringSlice("env-file"),
+		EnvPatterns:              c.StringSlice("env-pattern"),
+		UnsetEnv:                 c.StringSlice("unset-env"),
+		SeccompDeny:              c.StringSlice("seccomp-deny"),
+		SeccompAllow:             c.StringSlice("seccomp-allow"),
+	}
+	if paths, ok := c.Generic("path").(*customPathFlag); ok {
+		p.CustomPaths = append(p.CustomPaths, *paths...)
+	}
+	for _, name := range []string{"rw-create", "rwx-create"} {
+		for _, spec := range c.StringSlice(name) {
+			cp, err := sandbox.ParseCreatePath(spec, name == "rwx-create")
+			if err != nil {
+				return nil, fmt.Errorf("--%s: %w", name, err)
+			}
+			p.CreatePaths = append(p.CreatePaths, cp)
+		}
+	}
+	strs := []struct {
+		name     string
+		dst      *string
+		validate func(string) error
+	}{
+		{"missing-paths", &p.MissingPaths, sandbox.ValidateMissingPolicy},
+		{"seccomp", &p.Seccomp, seccomp.ValidateMode},
+		{"seccomp-action", &p.SeccompAction, seccomp.ValidateAction},
+		{"seccomp-profile", &p.SeccompProfile, func(string) error { return nil }},
+		{"env-preset", &p.EnvPreset, env.ValidatePreset},
+	}
+	for _, f := range strs {
+		if !c.IsSet(f.name) {
+			continue
+		}
+		*f.dst = c.String(f.name)
+		if err := f.validate(*f.dst); err != nil {
+			return nil, fmt.Errorf("--%s: %w", f.name, err)
+		}
+	}
+	portFlags := []struct {
+		name string
+		dst  *[]int
+	}{
+		{"bind-tcp", &p.BindTCPPorts},
+		{"connect-tcp", &p.ConnectTCPPorts},
+	}
+	for _, f := range portFlags {
+		for _, spec := range c.StringSlice(f.name) {
+			ports, err := sandbox.ParsePorts(spec)
+			if err != nil {
+				return nil, fmt.Errorf("--%s: %w", f.name, err)
 			}
-		} else {
-			// Flag already contains the value (KEY=VALUE format)
-			result = append(result, env)
+			*f.dst = append(*f.dst, ports...)
+		}
+	}
+	familyFlags := []struct {
+		name string
+		dst  *[]string
+	}{
+		{"allow-socket-family", &p.AllowSocketFamilies},
+		{"deny-socket-family", &p.DenySocketFamilies},
+	}
+	for _, f := range familyFlags {
+		for _, name := range c.StringSlice(f.name) {
+			family, err := seccomp.ParseSocketFamily(name)
+			if err != nil {
+				return nil, fmt.Errorf("--%s: %w", f.name, err)
+			}
+			*f.dst = append(*f.dst, family)
+		}
+	}
+	for _, v := range c.StringSlice("var") {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --var %q, expected NAME=VALUE", v)
+		}
+		if p.Vars == nil {
+			p.Vars = map[string]string{}
+		}
+		p.Vars[name] = value
+	}
+	for _, name := range rlimit.Names() {
+		if !c.IsSet("limit-" + name) {
+			continue
+		}
+		l, err := rlimit.Parse(name, c.String("limit-"+name))
+		if err != nil {
+			return nil, fmt.Errorf("--limit-%s: %w", name, err)
+		}
+		if p.Limits == nil {
+			p.Limits = map[string]rlimit.Limit{}
+		}
+		p.Limits[name] = l
+	}
+	p.Attribute(func(key string) string { return "--" + key })
+	flags := map[string]**bool{
+		"best-effort":             &p.BestEffort,
+		"unrestricted-filesystem": &p.UnrestrictedFilesystem,
+		"unrestricted-network":    &p.UnrestrictedNetwork,
+		"no-udp":                  &p.NoUDP,
+		"scope-abstract-unix":     &p.ScopeAbstractUnix,
+		"scope-signal":            &p.ScopeSignal,
+		"ldd":                     &p.Ldd,
+		"ldd-heuristics":          &p.LddHeuristics,
+		"add-exec":                &p.AddExec,
+		"fail-empty-glob":         &p.FailEmptyGlob,
+		"strict-vars":             &p.StrictVars,
+		"inherit-env":             &p.InheritEnv,
+		"env-strict":              &p.EnvStrict,
+	}
+	for name, dst := range flags {
+		if c.IsSet(name) {
+			v := c.Bool(name)
+			*dst = &v
+		}
+	}
+	return p, nil
+}
+
+// printPreset prints the options granted by a preset, one line per key.
+func printPreset(name string, p *profile.Profile) {
+	fmt.Printf("%s: %s\n", name, p.Description)
+	lists := []struct {
+		key    string
+		values []string
+	}{
+		{"preset", p.Presets},
+		{"ro", p.ReadOnlyPaths},
+		{"rox", p.ReadOnlyExecutablePaths},
+		{"rw", p.ReadWritePaths},
+		{"rwx", p.ReadWriteExecutablePaths},
+		{"path", customPathStrings(p.CustomPaths)},
+		{"deny", p.DenyPaths},
+		{"rw-create", createPathStrings(p.CreatePaths, false)},
+		{"rwx-create", createPathStrings(p.CreatePaths, true)},
+		{"bind-tcp", portStrings(p.BindTCPPorts)},
+		{"connect-tcp", portStrings(p.ConnectTCPPorts)},
+		{"allow-socket-family", p.AllowSocketFamilies},
+		{"deny-socket-family", p.DenySocketFamilies},
+		{"env", p.Env},
+		{"env-file", p.EnvFiles},
+		{"env-pattern", p.EnvPatterns},
+		{"unset-env", p.UnsetEnv},
+		{"vars", varStrings(p.Vars)},
+		{"seccomp-deny", p.SeccompDeny},
+		{"seccomp-allow", p.SeccompAllow},
+	}
+	for _, l := range lists {
+		if len(l.values) > 0 {
+			fmt.Printf("  %-12s %s\n", l.key+":", strings.Join(l.values, ", "))
+		}
+	}
+	bools := []struct {
+		key   string
+		value *bool
+	}{
+		{"best-effort", p.BestEffort},
+		{"unrestricted-filesystem", p.UnrestrictedFilesystem},
+		{"unrestricted-network", p.UnrestrictedNetwork},
+		{"no-udp", p.NoUDP},
+		{"scope-abstract-unix", p.ScopeAbstractUnix},
+		{"scope-signal", p.ScopeSignal},
+		{"ldd", p.Ldd},
+		{"ldd-heuristics", p.LddHeuristics},
+		{"add-exec", p.AddExec},
+		{"fail-empty-glob", p.FailEmptyGlob},
+		{"strict-vars", p.StrictVars},
+		{"inherit-env", p.InheritEnv},
+		{"env-strict", p.EnvStrict},
+	}
+	for _, b := range bools {
+		if b.value != nil {
+			fmt.Printf("  %-12s %t\n", b.key+":", *b.value)
 		}
 	}
+	for _, s := range []struct{ key, value string }{
+		{"missing-paths", p.MissingPaths},
+		{"seccomp", p.Seccomp},
+		{"seccomp-action", p.SeccompAction},
+		{"seccomp-profile", p.SeccompProfile},
+		{"env-preset", p.EnvPreset},
+	} {
+		if s.value != "" {
+			fmt.Printf("  %-12s %s\n", s.key+":", s.value)
+		}
+	}
+	for _, l := range p.ResourceLimits() {
+		fmt.Printf("  %-12s %s\n", "limit-"+l.Name+":", l)
+	}
+}
+
+// customPathFlag collects --path values. Unlike string slice flags the values
+// are not split on commas, which separate the access rights.
+type customPathFlag []sandbox.CustomPath
+
+func (f *customPathFlag) Set(value string) error {
+	cp, err := sandbox.ParseCustomPath(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, cp)
+	return nil
+}
 
-	return result
+func (f *customPathFlag) String() string {
+	return strings.Join(customPathStrings(*f), " ")
+}
+
+func customPathStrings(paths []sandbox.CustomPath) []string {
+	out := make([]string, 0, len(paths))
+	for _, cp := range paths {
+		out = append(out, cp.String())
+	}
+	return out
+}
+
+func createPathStrings(paths []sandbox.CreatePath, exec bool) []string {
+	var out []string
+	for _, cp := range paths {
+		if cp.Exec == exec {
+			out = append(out, cp.String())
+		}
+	}
+	return out
+}
+
+func varStrings(vars map[string]string) []string {
+	out := make([]string, 0, len(vars))
+	for name, value := range vars {
+		out = append(out, name+"="+value)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func portStrings(ports []int) []string {
+	out := make([]string, 0, len(ports))
+	for _, port := range ports {
+		out = append(out, fmt.Sprint(port))
+	}
+	return out
 }
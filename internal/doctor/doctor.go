@@ -0,0 +1,250 @@
+// Package doctor inspects the Landlock support of the running kernel and
+// explains how it affects landrun's flags.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"github.com/zouuup/landrun/internal/sandbox"
+)
+
+// lsmPath lists the active Linux security modules when securityfs is mounted.
+const lsmPath = "/sys/kernel/security/lsm"
+
+// Feature describes a Landlock feature and whether the kernel provides it.
+type Feature struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	MinABI      int      `json:"min_abi"`
+	Available   bool     `json:"available"`
+	Flags       []string `json:"flags,omitempty"`
+}
+
+// Report is the result of probing the host.
+type Report struct {
+	Kernel     string    `json:"kernel"`
+	ABIVersion int       `json:"abi_version"`
+	ABIError   string    `json:"abi_error,omitempty"`
+	TargetABI  int       `json:"landrun_target_abi"`
+	LSMs       []string  `json:"lsms,omitempty"`
+	LSMError   string    `json:"lsm_error,omitempty"`
+	Landlock   *bool     `json:"landlock_in_lsm_list,omitempty"`
+	Features   []Feature `json:"features"`
+	Impact     []string  `json:"impact"`
+}
+
+// features lists the Landlock features landrun cares about, in ABI order.
+var features = []Feature{
+	{
+		Name:        "filesystem",
+		Description: "Restrict reading, writing, executing and creating files",
+		MinABI:      1,
+		Flags:       []string{"--ro", "--rox", "--rw", "--rwx"},
+	},
+	{
+		Name:        "refer",
+		Description: "Allow renaming and linking files between directories",
+		MinABI:      2,
+		Flags:       []string{"--rw", "--rwx"},
+	},
+	{
+		Name:        "truncate",
+		Description: "Restrict truncating files",
+		MinABI:      3,
+		Flags:       []string{"--rw", "--rwx"},
+	},
+	{
+		Name:        "tcp_bind",
+		Description: "Restrict binding TCP ports",
+		MinABI:      4,
+		Flags:       []string{"--bind-tcp"},
+	},
+	{
+		Name:        "tcp_connect",
+		Description: "Restrict connecting to TCP ports",
+		MinABI:      4,
+		Flags:       []string{"--connect-tcp"},
+	},
+	{
+		Name:        "ioctl_dev",
+		Description: "Restrict ioctl on character and block devices",
+		MinABI:      5,
+		Flags:       []string{"--rw", "--rwx"},
+	},
+	{
+		Name:        "scope_abstract_unix_socket",
+		Description: "Block connecting to abstract unix sockets outside the sandbox",
+		MinABI:      6,
+		Flags:       []string{"--scope-abstract-unix"},
+	},
+	{
+		Name:        "scope_signal",
+		Description: "Block sending signals to processes outside the sandbox",
+		MinABI:      6,
+		Flags:       []string{"--scope-signal"},
+	},
+}
+
+// Probe inspects the running kernel.
+func Probe() *Report {
+	abi, abiErr := ll.LandlockGetABIVersion()
+	if abiErr != nil {
+		abi = 0
+	}
+	lsms, lsmErr := readLSMs()
+	return newReport(kernelRelease(), abi, abiErr, lsms, lsmErr)
+}
+
+// Usable reports whether Landlock can be used at all on this host.
+func (r *Report) Usable() bool {
+	return r.ABIVersion > 0
+}
+
+// newReport builds a report from the probed values.
+func newReport(kernel string, abi int, abiErr error, lsms []string, lsmErr error) *Report {
+	r := &Report{
+		Kernel:     kernel,
+		ABIVersion: abi,
+		TargetABI:  sandbox.TargetABI,
+		LSMs:       lsms,
+	}
+	if abiErr != nil {
+		r.ABIError = describeABIError(abiErr)
+	}
+	if lsmErr != nil {
+		r.LSMError = lsmErr.Error()
+	} else {
+		enabled := false
+		for _, m := range lsms {
+			if m == "landlock" {
+				enabled = true
+			}
+		}
+		r.Landlock = &enabled
+	}
+	for _, f := range features {
+		f.Available = abi >= f.MinABI
+		r.Features = append(r.Features, f)
+	}
+	r.Impact = impact(abi)
+	return r
+}
+
+// impact explains which landrun flags are degraded or fail on a kernel with
+// the given Landlock ABI version.
+func impact(abi int) []string {
+	target := sandbox.TargetABI
+	if abi == 0 {
+		return []string{
+			"Landlock is unavailable: every landrun invocation fails unless --best-effort is given.",
+			"With --best-effort the command runs without any sandbox.",
+		}
+	}
+	if abi >= target {
+		out := []string{fmt.Sprintf("All Landlock features used by landrun (ABI v%d) are supported.", target)}
+		if abi < sandbox.ScopeABI {
+			out = append(out, fmt.Sprintf("Scoping (ABI v%d) is unavailable: --scope-abstract-unix and --scope-signal fail unless --best-effort is given, in which case they have no effect.", sandbox.ScopeABI))
+		}
+		if abi > sandbox.ScopeABI {
+			out = append(out, fmt.Sprintf("The kernel supports ABI v%d; features newer than v%d are not used by landrun yet.", abi, sandbox.ScopeABI))
+		}
+		return out
+	}
+
+	out := []string{
+		fmt.Sprintf("landrun configures Landlock ABI v%d but this kernel provides v%d: every invocation fails unless --best-effort is given.", target, abi),
+		"With --best-effort:",
+	}
+	if abi < 2 {
+		out = append(out, "  --rw and --rwx on directories need the refer right (ABI v2); when such a rule is present the filesystem sandbox is dropped entirely.",
+			"  Renaming or linking files between directories is always denied in the other cases.")
+	}
+	if abi < 3 {
+		out = append(out, "  Truncating files (ABI v3) is not restricted, even outside --rw paths.")
+	}
+	if abi < 4 {
+		out = append(out, "  TCP restrictions (ABI v4) are not enforced: --bind-tcp and --connect-tcp have no effect and all TCP traffic is allowed.")
+	}
+	if abi < 5 {
+		out = append(out, "  ioctl on device files (ABI v5) is not restricted, even outside --rw paths.")
+	}
+	out = append(out, fmt.Sprintf("  Scoping (ABI v%d) is not enforced: --scope-abstract-unix and --scope-signal have no effect.", sandbox.ScopeABI))
+	return out
+}
+
+// WriteText writes a human readable report.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Kernel:            %s\n", r.Kernel)
+	if r.ABIError != "" {
+		fmt.Fprintf(w, "Landlock ABI:      unavailable (%s)\n", r.ABIError)
+	} else {
+		fmt.Fprintf(w, "Landlock ABI:      v%d (landrun targets v%d)\n", r.ABIVersion, r.TargetABI)
+	}
+	switch {
+	case r.LSMError != "":
+		fmt.Fprintf(w, "Active LSMs:       unknown (%s)\n", r.LSMError)
+	case r.Landlock != nil && *r.Landlock:
+		fmt.Fprintf(w, "Active LSMs:       %s\n", strings.Join(r.LSMs, ","))
+	default:
+		fmt.Fprintf(w, "Active LSMs:       %s (landlock missing, add it to the lsm= boot parameter)\n", strings.Join(r.LSMs, ","))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Features:")
+	for _, f := range r.Features {
+		mark := "no "
+		if f.Available {
+			mark = "yes"
+		}
+		fmt.Fprintf(w, "  [%s] %-27s ABI v%d  %s", mark, f.Name, f.MinABI, f.Description)
+		if len(f.Flags) > 0 {
+			fmt.Fprintf(w, " (%s)", strings.Join(f.Flags, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Impact on landrun:")
+	for _, line := range r.Impact {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+// describeABIError turns the error of the ABI version query into a hint.
+func describeABIError(err error) string {
+	switch {
+	case errors.Is(err, syscall.ENOSYS):
+		return "kernel built without Landlock support (ENOSYS)"
+	case errors.Is(err, syscall.EOPNOTSUPP):
+		return "Landlock is built in but disabled at boot time (EOPNOTSUPP)"
+	}
+	return err.Error()
+}
+
+func readLSMs() ([]string, error) {
+	data, err := os.ReadFile(lsmPath)
+	if err != nil {
+		return nil, err
+	}
+	var lsms []string
+	for _, m := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		if m != "" {
+			lsms = append(lsms, m)
+		}
+	}
+	return lsms, nil
+}
+
+func kernelRelease() string {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
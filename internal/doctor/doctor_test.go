@@ -0,0 +1,76 @@
+package doctor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestReportFullySupported(t *testing.T) {
+	r := newReport("6.12.0", 6, nil, []string{"capability", "landlock", "yama"}, nil)
+	if !r.Usable() {
+		t.Fatalf("expected Landlock to be usable")
+	}
+	if r.Landlock == nil || !*r.Landlock {
+		t.Errorf("expected landlock to be found in LSM list")
+	}
+	for _, f := range r.Features {
+		if !f.Available {
+			t.Errorf("feature %s should be available on ABI v6", f.Name)
+		}
+	}
+	if len(r.Impact) == 0 || !strings.Contains(r.Impact[0], "are supported") {
+		t.Errorf("unexpected impact %v", r.Impact)
+	}
+}
+
+func TestReportOldKernel(t *testing.T) {
+	r := newReport("6.1.0", 2, nil, nil, errors.New("permission denied"))
+	if r.Landlock != nil {
+		t.Errorf("landlock LSM state should be unknown")
+	}
+	available := map[string]bool{}
+	for _, f := range r.Features {
+		available[f.Name] = f.Available
+	}
+	if !available["refer"] || available["truncate"] || available["tcp_connect"] {
+		t.Errorf("unexpected feature availability %v", available)
+	}
+
+	text := strings.Join(r.Impact, "\n")
+	for _, want := range []string{"fails unless --best-effort", "--bind-tcp and --connect-tcp have no effect", "Truncating"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("impact does not mention %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "refer right") {
+		t.Errorf("refer is supported on ABI v2, impact should not mention it:\n%s", text)
+	}
+}
+
+func TestReportNoLandlock(t *testing.T) {
+	r := newReport("5.10.0", 0, syscall.EOPNOTSUPP, []string{"capability", "apparmor"}, nil)
+	if r.Usable() {
+		t.Fatalf("expected Landlock to be unusable")
+	}
+	if !strings.Contains(r.ABIError, "disabled at boot") {
+		t.Errorf("unexpected ABI error %q", r.ABIError)
+	}
+
+	var text bytes.Buffer
+	r.WriteText(&text)
+	if !strings.Contains(text.String(), "landlock missing") {
+		t.Errorf("text output should point out the missing LSM:\n%s", text.String())
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if !strings.Contains(string(data), `"landlock_in_lsm_list":false`) {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
@@ -0,0 +1,104 @@
+package elfdeps
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"regexp"
+)
+
+// dlopenNoteType and dlopenNoteOwner identify the notes of the .note.dlopen
+// section, which list the libraries a program may load with dlopen. See
+// https://systemd.io/ELF_DLOPEN_METADATA/.
+const (
+	dlopenNoteType  = 0x407c0c0a
+	dlopenNoteOwner = "FDO"
+)
+
+// dlopenFeature is an entry of a .note.dlopen note. Soname lists
+// alternatives: the program loads the first one it finds.
+type dlopenFeature struct {
+	Feature     string   `json:"feature"`
+	Description string   `json:"description"`
+	Priority    string   `json:"priority"`
+	Soname      []string `json:"soname"`
+}
+
+// parseDlopenNotes returns the sonames listed in the .note.dlopen section
+// of f, one list of alternatives per feature. Malformed notes are ignored.
+func parseDlopenNotes(f *elf.File) [][]string {
+	sec := f.Section(".note.dlopen")
+	if sec == nil || sec.Type != elf.SHT_NOTE {
+		return nil
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return nil
+	}
+	align := 4
+	if sec.Addralign == 8 {
+		align = 8
+	}
+	pad := func(n int) int { return (n + align - 1) &^ (align - 1) }
+
+	var out [][]string
+	for len(data) >= 12 {
+		namesz := int(f.ByteOrder.Uint32(data[0:4]))
+		descsz := int(f.ByteOrder.Uint32(data[4:8]))
+		typ := f.ByteOrder.Uint32(data[8:12])
+		data = data[12:]
+		if namesz < 0 || descsz < 0 || pad(namesz) > len(data) || pad(namesz)+descsz > len(data) {
+			break
+		}
+		name := string(bytes.TrimRight(data[:namesz], "\x00"))
+		desc := bytes.TrimRight(data[pad(namesz):pad(namesz)+descsz], "\x00")
+		if next := pad(namesz) + pad(descsz); next < len(data) {
+			data = data[next:]
+		} else {
+			data = nil
+		}
+		if typ != dlopenNoteType || name != dlopenNoteOwner {
+			continue
+		}
+		var features []dlopenFeature
+		if err := json.Unmarshal(desc, &features); err != nil {
+			continue
+		}
+		for _, feature := range features {
+			if len(feature.Soname) > 0 {
+				out = append(out, feature.Soname)
+			}
+		}
+	}
+	return out
+}
+
+// sonamePattern matches strings that look like the soname of a library.
+var sonamePattern = regexp.MustCompile(`^lib[A-Za-z0-9_+-]+(\.[A-Za-z0-9_+-]+)*\.so(\.[0-9]+)*$`)
+
+// scanRodata returns the strings in the .rodata section of f that look like
+// sonames, such as the argument of dlopen("libfoo.so.1", ...). This is a
+// guess: the program may never load them, or build the names at runtime.
+func scanRodata(f *elf.File) []string {
+	sec := f.Section(".rodata")
+	if sec == nil || sec.Type == elf.SHT_NOBITS {
+		return nil
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range bytes.Split(data, []byte{0}) {
+		// The shortest soname is "libX.so".
+		if len(s) < 7 || len(s) > 255 || !bytes.HasPrefix(s, []byte("lib")) {
+			continue
+		}
+		if name := string(s); !seen[name] && sonamePattern.MatchString(name) {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -71,31 +71,32 @@ func parseInterp(f *elf.File) string {
 
 // parseDynamic extracts DT_NEEDED and RPATH/RUNPATH entries from the .dynamic section.
 func parseDynamic(f *elf.File) (needed []string, rpaths []string) {
-	needed = []string{}
-	rpaths = []string{}
+	needed, rpath, runpath := parseSearchPaths(f)
+	return needed, append(rpath, runpath...)
+}
 
+// parseSearchPaths extracts the DT_NEEDED entries and the DT_RPATH and
+// DT_RUNPATH search paths, split on ':', from the .dynamic section.
+func parseSearchPaths(f *elf.File) (needed, rpath, runpath []string) {
+	needed = []string{}
 	if libs, err := f.DynString(elf.DT_NEEDED); err == nil {
 		needed = append(needed, libs...)
 	}
-
-	// DT_RPATH and DT_RUNPATH may both be present; split on ':' and append
-	if rp, err := f.DynString(elf.DT_RPATH); err == nil {
-		for _, v := range rp {
-			if v == "" {
-				continue
-			}
-			rpaths = append(rpaths, strings.Split(v, ":")...)
+	split := func(tag elf.DynTag) []string {
+		paths := []string{}
+		values, err := f.DynString(tag)
+		if err != nil {
+			return paths
 		}
-	}
-	if rp, err := f.DynString(elf.DT_RUNPATH); err == nil {
-		for _, v := range rp {
+		for _, v := range values {
 			if v == "" {
 				continue
 			}
-			rpaths = append(rpaths, strings.Split(v, ":")...)
+			paths = append(paths, strings.Split(v, ":")...)
 		}
+		return paths
 	}
-	return
+	return needed, split(elf.DT_RPATH), split(elf.DT_RUNPATH)
 }
 
 // normalizeRpaths expands common tokens like $ORIGIN and makes relative
@@ -118,14 +119,25 @@ func normalizeRpaths(rpaths []string, origin string) []string {
 	return out
 }
 
+// standardDirs are the library directories searched after the RPATH and
+// RUNPATH entries.
+var standardDirs = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64", "/usr/local/lib"}
+
+// exists accepts every existing file as a library.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 // resolveSingleSoname attempts to resolve a single soname using rpaths,
 // standard dirs and ldconfig fallback. It takes a pointer to ldmap so the
-// caller can lazily populate and reuse it.
-func resolveSingleSoname(soname string, rpaths []string, stdDirs []string, ldmap *map[string]string) string {
+// caller can lazily populate and reuse it. Candidates in rpaths and stdDirs
+// are only returned if usable accepts them.
+func resolveSingleSoname(soname string, rpaths []string, stdDirs []string, ldmap *map[string]string, usable func(path string) bool) string {
 	// check rpaths first
 	for _, rp := range rpaths {
 		candidate := filepath.Join(rp, soname)
-		if _, err := os.Stat(candidate); err == nil {
+		if usable(candidate) {
 			return candidate
 		}
 	}
@@ -133,11 +145,10 @@ func resolveSingleSoname(soname string, rpaths []string, stdDirs []string, ldmap
 	// then check standard dirs
 	for _, d := range stdDirs {
 		candidate := filepath.Join(d, soname)
-		if _, err := os.Stat(candidate); err == nil {
+		if usable(candidate) {
 			return candidate
 		}
 	}
-
 	// fallback: consult parsed ldconfig map (populate lazily)
 	if *ldmap == nil {
 		*ldmap = getLdmap()
@@ -153,14 +164,13 @@ func resolveSingleSoname(soname string, rpaths []string, stdDirs []string, ldmap
 // standard library directories and falling back to parsing `ldconfig -p` output.
 func resolveSonames(needed []string, rpaths []string) []string {
 	resolved := map[string]string{}
-	stdDirs := []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64", "/usr/local/lib"}
 	var ldmap map[string]string
 
 	for _, soname := range needed {
 		if _, ok := resolved[soname]; ok {
 			continue
 		}
-		resolved[soname] = resolveSingleSoname(soname, rpaths, stdDirs, &ldmap)
+		resolved[soname] = resolveSingleSoname(soname, rpaths, standardDirs, &ldmap, exists)
 	}
 
 	out := []string{}
@@ -172,37 +182,233 @@ func resolveSonames(needed []string, rpaths []string) []string {
 	return out
 }
 
-// GetLibraryDependencies returns a list of library paths that the given binary depends on
+// How a dependency was found.
+const (
+	// FoundNeeded is the interpreter, the DT_NEEDED libraries and the
+	// libraries they need in turn.
+	FoundNeeded = "needed"
+	// FoundDlopenNote is a library listed in a .note.dlopen note.
+	FoundDlopenNote = "dlopen-note"
+	// FoundHeuristic is a library whose soname appears in .rodata.
+	FoundHeuristic = "heuristic"
+)
+
+// Options select the libraries loaded with dlopen that GetDependencies
+// includes besides the needed ones.
+type Options struct {
+	// DlopenNotes includes the libraries declared in the .note.dlopen
+	// sections of the binary and its libraries.
+	DlopenNotes bool
+	// Heuristics includes the libraries whose sonames appear as strings
+	// in the .rodata sections of the binary and its libraries.
+	Heuristics bool
+}
+
+// Dependency is a file a binary needs to run.
+type Dependency struct {
+	Path string
+	// Found is FoundNeeded, FoundDlopenNote or FoundHeuristic. The
+	// libraries needed by a library loaded with dlopen are found the same
+	// way as that library.
+	Found string
+}
+
+// Optional reports whether the binary may run without d: whether it is
+// only loaded with dlopen.
+func (d Dependency) Optional() bool {
+	return d.Found != FoundNeeded
+}
+
+// object is a loaded ELF object whose dependencies remain to be resolved.
+type object struct {
+	path string
+	// inherited are the DT_RPATH entries of the objects that loaded it,
+	// nearest first, which ld.so also searches for its dependencies unless
+	// it has a DT_RUNPATH.
+	inherited []string
+	found     string
+}
+
+// request is a library to load: the first of sonames that is found in
+// search.
+type request struct {
+	sonames   []string
+	search    []string
+	inherited []string
+	found     string
+}
+
+// compatible returns a function accepting the libraries that can be loaded
+// into f: ELF files of the same class and machine.
+func compatible(f *elf.File) func(path string) bool {
+	return func(path string) bool {
+		lib, err := elf.Open(path)
+		if err != nil {
+			return false
+		}
+		defer lib.Close()
+		return lib.Class == f.Class && lib.Machine == f.Machine
+	}
+}
+
+// GetLibraryDependencies returns a list of library paths that the given
+// binary depends on: its interpreter, the libraries it needs and, like
+// ld.so, the libraries those need in turn, each looked up in the RPATH and
+// RUNPATH of the object that needs it. Libraries are resolved once per
+// soname, so dependency cycles are harmless. The paths are in load order.
 func GetLibraryDependencies(binary string) ([]string, error) {
+	deps, err := GetDependencies(binary, Options{})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(deps))
+	for _, d := range deps {
+		paths = append(paths, d.Path)
+	}
+	return paths, nil
+}
+
+// GetDependencies returns the dependencies of binary like
+// GetLibraryDependencies and, as selected by opts, the libraries it and its
+// libraries may load with dlopen, looked up the same way. Needed libraries
+// come first, so that a library both needed and loaded with dlopen is not
+// optional. Optional libraries that can't be found are left out.
+func GetDependencies(binary string, opts Options) ([]Dependency, error) {
 	f, err := elf.Open(binary)
 	if err != nil {
 		return nil, fmt.Errorf("open ELF %s: %w", binary, err)
 	}
 	defer f.Close()
 
-	interpPath := parseInterp(f)
-	needed, rpaths := parseDynamic(f)
-	origin := filepath.Dir(binary)
-	rpaths = normalizeRpaths(rpaths, origin)
-	libPaths := resolveSonames(needed, rpaths)
-
-	// Dedupe using a map
-	finalMap := map[string]struct{}{}
-	if interpPath != "" {
-		finalMap[interpPath] = struct{}{}
+	out := []Dependency{}
+	seen := map[string]bool{}
+	add := func(path, found string) {
+		if !seen[path] {
+			seen[path] = true
+			out = append(out, Dependency{Path: path, Found: found})
+		}
 	}
-	for _, p := range libPaths {
-		finalMap[p] = struct{}{}
+	if interpPath := parseInterp(f); interpPath != "" {
+		add(interpPath, FoundNeeded)
 	}
-	// Add /etc/ld.so.cache if present
-	if _, err := os.Stat("/etc/ld.so.cache"); err == nil {
-		finalMap["/etc/ld.so.cache"] = struct{}{}
+
+	// $ORIGIN of the executable is the directory of the file the kernel
+	// executes, with symlinks resolved.
+	origin := filepath.Dir(binary)
+	if real, err := filepath.EvalSymlinks(binary); err == nil {
+		origin = filepath.Dir(real)
 	}
+	usable := compatible(f)
+	loaded := map[string]bool{}
+	var ldmap map[string]string
+	queue := []object{{path: binary, found: FoundNeeded}}
+	// Libraries loaded with dlopen are only resolved once the needed ones
+	// are, the declared ones before the guessed ones.
+	var notes, guesses []request
 
-	out := make([]string, 0, len(finalMap))
-	for p := range finalMap {
-		out = append(out, p)
+	load := func(req request) {
+		for _, soname := range req.sonames {
+			if loaded[soname] {
+				return
+			}
+		}
+		for _, soname := range req.sonames {
+			path := soname
+			if strings.Contains(soname, "/") {
+				// Names with a slash are paths, not searched for.
+				if !usable(path) {
+					continue
+				}
+			} else {
+				path = resolveSingleSoname(soname, req.search, standardDirs, &ldmap, usable)
+			}
+			if path == "" {
+				continue
+			}
+			loaded[soname] = true
+			if !seen[path] {
+				add(path, req.found)
+				queue = append(queue, object{path: path, inherited: req.inherited, found: req.found})
+			}
+			return
+		}
+		// Not found: needed libraries are not looked up again.
+		if req.found == FoundNeeded {
+			for _, soname := range req.sonames {
+				loaded[soname] = true
+			}
+		}
 	}
 
-	return out, nil
+	for i := 0; ; i++ {
+		if len(queue) == 0 {
+			switch {
+			case len(notes) > 0:
+				load(notes[0])
+				notes = notes[1:]
+			case len(guesses) > 0:
+				load(guesses[0])
+				guesses = guesses[1:]
+			default:
+				// Add /etc/ld.so.cache if present
+				if _, err := os.Stat("/etc/ld.so.cache"); err == nil {
+					add("/etc/ld.so.cache", FoundNeeded)
+				}
+				return out, nil
+			}
+			continue
+		}
+		obj := queue[0]
+		queue = queue[1:]
+
+		lf := f
+		if i > 0 {
+			// Libraries that can't be parsed are still granted.
+			if lf, err = elf.Open(obj.path); err != nil {
+				continue
+			}
+			origin = filepath.Dir(obj.path)
+		}
+		needed, rpath, runpath := parseSearchPaths(lf)
+		var dlopened [][]string
+		var guessed []string
+		if opts.DlopenNotes {
+			dlopened = parseDlopenNotes(lf)
+		}
+		if opts.Heuristics {
+			guessed = scanRodata(lf)
+		}
+		if lf != f {
+			lf.Close()
+		}
+
+		// DT_RPATH is ignored when DT_RUNPATH is present, and only
+		// DT_RPATH is inherited by the dependencies.
+		var search, inherited []string
+		if len(runpath) == 0 {
+			inherited = append(normalizeRpaths(rpath, origin), obj.inherited...)
+			search = inherited
+		} else {
+			search = normalizeRpaths(runpath, origin)
+		}
+		for _, soname := range needed {
+			load(request{sonames: []string{soname}, search: search, inherited: inherited, found: obj.found})
+		}
+		// The libraries a library loaded with dlopen loads in turn are
+		// found the same way.
+		for _, sonames := range dlopened {
+			found := obj.found
+			if found == FoundNeeded {
+				found = FoundDlopenNote
+			}
+			notes = append(notes, request{sonames: sonames, search: search, inherited: inherited, found: found})
+		}
+		for _, soname := range guessed {
+			found := obj.found
+			if found == FoundNeeded {
+				found = FoundHeuristic
+			}
+			guesses = append(guesses, request{sonames: []string{soname}, search: search, inherited: inherited, found: found})
+		}
+	}
 }
@@ -1,14 +1,143 @@
 package elfdeps
 
 import (
+	"bytes"
 	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
-// Test helpers against a known binary in the system: find `true` via LookPath
+// writeELF writes a minimal 64-bit ELF shared object with a .dynamic
+// section holding the given DT_NEEDED entries and, if not empty, DT_RPATH
+// and DT_RUNPATH.
+func writeELF(t *testing.T, path string, machine elf.Machine, needed []string, rpath, runpath string) {
+	t.Helper()
+	writeELFSections(t, path, machine, needed, rpath, runpath)
+}
+
+// extraSection is a section added by writeELFSections.
+type extraSection struct {
+	name  string
+	typ   elf.SectionType
+	data  []byte
+	align uint64
+}
+
+// writeELFSections is writeELF with extra sections.
+func writeELFSections(t *testing.T, path string, machine elf.Machine, needed []string, rpath, runpath string, extra ...extraSection) {
+	t.Helper()
+	dynstr := []byte{0}
+	str := func(s string) uint64 {
+		off := len(dynstr)
+		dynstr = append(append(dynstr, s...), 0)
+		return uint64(off)
+	}
+	var dyn []elf.Dyn64
+	for _, n := range needed {
+		dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: str(n)})
+	}
+	if rpath != "" {
+		dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_RPATH), Val: str(rpath)})
+	}
+	if runpath != "" {
+		dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_RUNPATH), Val: str(runpath)})
+	}
+	dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+	var dynamic bytes.Buffer
+	binary.Write(&dynamic, binary.LittleEndian, dyn)
+
+	sections := append([]extraSection{
+		{name: ".dynstr", typ: elf.SHT_STRTAB, data: dynstr, align: 1},
+		{name: ".dynamic", typ: elf.SHT_DYNAMIC, data: dynamic.Bytes(), align: 8},
+	}, extra...)
+	shstrtab := []byte{0}
+	for _, sec := range sections {
+		shstrtab = append(append(shstrtab, sec.name...), 0)
+	}
+	shstrtab = append(shstrtab, ".shstrtab\x00"...)
+	sections = append(sections, extraSection{name: ".shstrtab", typ: elf.SHT_STRTAB, data: shstrtab, align: 1})
+
+	const headerSize = 64
+	var body bytes.Buffer
+	headers := []elf.Section64{{}}
+	name := uint32(1)
+	for _, sec := range sections {
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+		h := elf.Section64{
+			Name:      name,
+			Type:      uint32(sec.typ),
+			Off:       uint64(headerSize + body.Len()),
+			Size:      uint64(len(sec.data)),
+			Addralign: sec.align,
+		}
+		if sec.typ == elf.SHT_DYNAMIC {
+			h.Link, h.Entsize = 1, 16
+		}
+		headers = append(headers, h)
+		name += uint32(len(sec.name)) + 1
+		body.Write(sec.data)
+	}
+	for body.Len()%8 != 0 {
+		body.WriteByte(0)
+	}
+
+	var b bytes.Buffer
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(headerSize + body.Len()),
+		Ehsize:    headerSize,
+		Shentsize: 64,
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  uint16(len(headers) - 1),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	binary.Write(&b, binary.LittleEndian, hdr)
+	b.Write(body.Bytes())
+	binary.Write(&b, binary.LittleEndian, headers)
+	if err := os.WriteFile(path, b.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dlopenNote returns a .note.dlopen section declaring features, which are
+// lists of alternative sonames.
+func dlopenNote(t *testing.T, features ...[]string) extraSection {
+	t.Helper()
+	var list []dlopenFeature
+	for _, sonames := range features {
+		list = append(list, dlopenFeature{Feature: "test", Priority: "recommended", Soname: sonames})
+	}
+	desc, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc = append(desc, 0)
+	var b bytes.Buffer
+	// Another vendor's note, which is skipped.
+	binary.Write(&b, binary.LittleEndian, []uint32{4, 4, 1})
+	b.WriteString("GNU\x00\x01\x02\x03\x04")
+	binary.Write(&b, binary.LittleEndian, []uint32{4, uint32(len(desc)), dlopenNoteType})
+	b.WriteString(dlopenNoteOwner + "\x00")
+	b.Write(desc)
+	for b.Len()%4 != 0 {
+		b.WriteByte(0)
+	}
+	return extraSection{name: ".note.dlopen", typ: elf.SHT_NOTE, data: b.Bytes(), align: 4}
+}
+
 func TestParseAndResolveTrue(t *testing.T) {
 	bin, err := exec.LookPath("true")
 	if err != nil {
@@ -164,3 +293,182 @@ func TestResolveSonamesOriginExpansion(t *testing.T) {
 		t.Fatalf("expected %s, got %s", libPath, out2[0])
 	}
 }
+
+func TestGetLibraryDependenciesTransitive(t *testing.T) {
+	original := ldconfigRunner
+	defer func() { ldconfigRunner = original }()
+	ldconfigRunner = func() ([]byte, error) { return nil, nil }
+
+	// app finds libssl and libplugin in its RPATH. libssl has a RUNPATH,
+	// so it finds libcrypto next to itself rather than the decoy in the
+	// RPATH of app, and libcrypto needing libssl back is not a problem.
+	// libplugin has no search path of its own and finds libz in the RPATH
+	// inherited from app, where a library for another machine is skipped.
+	root := t.TempDir()
+	for _, dir := range []string{"bin", "lib", "plugins", "other", "zlib"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := elf.EM_X86_64
+	rpath := "$ORIGIN/../plugins:" + filepath.Join(root, "other") + ":" + filepath.Join(root, "zlib") + ":$ORIGIN/../lib"
+	writeELF(t, filepath.Join(root, "bin", "app"), m, []string{"libssl.so.3", "libplugin.so"}, rpath, "")
+	writeELF(t, filepath.Join(root, "lib", "libssl.so.3"), m, []string{"libcrypto.so.3"}, "", "$ORIGIN")
+	writeELF(t, filepath.Join(root, "lib", "libcrypto.so.3"), m, []string{"libssl.so.3"}, "", "$ORIGIN")
+	writeELF(t, filepath.Join(root, "plugins", "libcrypto.so.3"), m, nil, "", "")
+	writeELF(t, filepath.Join(root, "plugins", "libplugin.so"), m, []string{"libz.so.1", "libmissing.so"}, "", "")
+	writeELF(t, filepath.Join(root, "other", "libz.so.1"), elf.EM_AARCH64, nil, "", "")
+	writeELF(t, filepath.Join(root, "zlib", "libz.so.1"), m, nil, "", "")
+
+	got, err := GetLibraryDependencies(filepath.Join(root, "bin", "app"))
+	if err != nil {
+		t.Fatalf("GetLibraryDependencies failed: %v", err)
+	}
+	if n := len(got); n > 0 && got[n-1] == "/etc/ld.so.cache" {
+		got = got[:n-1]
+	}
+	want := []string{
+		filepath.Join(root, "lib", "libssl.so.3"),
+		filepath.Join(root, "plugins", "libplugin.so"),
+		filepath.Join(root, "lib", "libcrypto.so.3"),
+		filepath.Join(root, "zlib", "libz.so.1"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dependencies = %q, want %q", got, want)
+	}
+}
+
+func TestInterpreters(t *testing.T) {
+	root := t.TempDir()
+	bin := filepath.Join(root, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := filepath.Join(root, "app")
+	writeELF(t, app, elf.EM_X86_64, nil, "", "")
+	write(filepath.Join(bin, "tool"), "#!"+app+" --flag\n")
+	script := filepath.Join(root, "script")
+	write(script, "#!/usr/bin/env -S -u HOME LANG=C tool -x\necho hi\n")
+
+	got, err := Interpreters(script, "/nonexistent:"+bin)
+	if err != nil {
+		t.Fatalf("Interpreters failed: %v", err)
+	}
+	want := []string{"/usr/bin/env", filepath.Join(bin, "tool"), app}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Interpreters = %q, want %q", got, want)
+	}
+
+	if got, err := Interpreters(app, bin); err != nil || len(got) != 0 {
+		t.Errorf("Interpreters of an ELF binary = %q, %v, want none", got, err)
+	}
+	if _, err := Interpreters(script, root); err == nil {
+		t.Error("expected an error for an interpreter missing from PATH")
+	}
+
+	// Scripts interpreted by scripts, beyond what the kernel follows.
+	prev := app
+	for i := 0; i < 5; i++ {
+		next := filepath.Join(root, fmt.Sprintf("level%d", i))
+		write(next, "#!"+prev+"\n")
+		prev = next
+	}
+	if _, err := Interpreters(prev, bin); err == nil {
+		t.Error("expected an error for too many levels of interpreters")
+	}
+}
+
+func TestGetExecutableDependencies(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := elf.EM_X86_64
+	interp := filepath.Join(root, "interp")
+	writeELF(t, interp, m, []string{"libinterp.so"}, "", "$ORIGIN/lib")
+	writeELF(t, filepath.Join(root, "lib", "libinterp.so"), m, nil, "", "")
+	wrapper := filepath.Join(root, "wrapper")
+	script := filepath.Join(root, "script")
+	if err := os.WriteFile(wrapper, []byte("#! "+interp+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("#!"+wrapper+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := GetExecutableDependencies(script, "", Options{})
+	if err != nil {
+		t.Fatalf("GetExecutableDependencies failed: %v", err)
+	}
+	var got []string
+	for _, d := range deps {
+		if d.Path != "/etc/ld.so.cache" {
+			got = append(got, d.Path)
+		}
+	}
+	want := []string{wrapper, interp, filepath.Join(root, "lib", "libinterp.so")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dependencies = %q, want %q", got, want)
+	}
+}
+
+func TestGetDependenciesDlopen(t *testing.T) {
+	root := t.TempDir()
+	lib := filepath.Join(root, "lib")
+	if err := os.MkdirAll(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := elf.EM_X86_64
+	rodata := extraSection{
+		name:  ".rodata",
+		typ:   elf.SHT_PROGBITS,
+		data:  []byte("usage: %s\x00libguess.so.2\x00libnotthere.so.1\x00not libfoo.so\x00libneeded.so\x00"),
+		align: 1,
+	}
+	writeELFSections(t, filepath.Join(root, "app"), m, []string{"libneeded.so"}, "", "$ORIGIN/lib",
+		dlopenNote(t, []string{"libmissing.so.1", "libplugin.so.1"}, []string{"libneeded.so"}), rodata)
+	writeELF(t, filepath.Join(lib, "libneeded.so"), m, nil, "", "")
+	writeELF(t, filepath.Join(lib, "libplugin.so.1"), m, []string{"libplugindep.so", "libneeded.so"}, "", "$ORIGIN")
+	writeELF(t, filepath.Join(lib, "libplugindep.so"), m, nil, "", "")
+	writeELF(t, filepath.Join(lib, "libguess.so.2"), m, nil, "", "")
+	original := ldconfigRunner
+	defer func() { ldconfigRunner = original }()
+	ldconfigRunner = func() ([]byte, error) { return nil, nil }
+
+	for _, tc := range []struct {
+		opts Options
+		want []Dependency
+	}{
+		{Options{}, []Dependency{
+			{filepath.Join(lib, "libneeded.so"), FoundNeeded},
+		}},
+		{Options{DlopenNotes: true}, []Dependency{
+			{filepath.Join(lib, "libneeded.so"), FoundNeeded},
+			{filepath.Join(lib, "libplugin.so.1"), FoundDlopenNote},
+			{filepath.Join(lib, "libplugindep.so"), FoundDlopenNote},
+		}},
+		{Options{DlopenNotes: true, Heuristics: true}, []Dependency{
+			{filepath.Join(lib, "libneeded.so"), FoundNeeded},
+			{filepath.Join(lib, "libplugin.so.1"), FoundDlopenNote},
+			{filepath.Join(lib, "libplugindep.so"), FoundDlopenNote},
+			{filepath.Join(lib, "libguess.so.2"), FoundHeuristic},
+		}},
+	} {
+		deps, err := GetDependencies(filepath.Join(root, "app"), tc.opts)
+		if err != nil {
+			t.Fatalf("GetDependencies(%+v) failed: %v", tc.opts, err)
+		}
+		if n := len(deps); n > 0 && deps[n-1].Path == "/etc/ld.so.cache" {
+			deps = deps[:n-1]
+		}
+		if !reflect.DeepEqual(deps, tc.want) {
+			t.Errorf("GetDependencies(%+v) = %v, want %v", tc.opts, deps, tc.want)
+		}
+	}
+}
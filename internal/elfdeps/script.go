@@ -0,0 +1,188 @@
+package elfdeps
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSearchPath is the PATH env(1) searches when the command has no
+// PATH variable, as execvp does.
+const DefaultSearchPath = "/bin:/usr/bin"
+
+// maxInterpreterDepth is how many levels of scripts running scripts the
+// kernel follows.
+const maxInterpreterDepth = 4
+
+// shebangSize is how much of the first line of a script the kernel reads.
+const shebangSize = 256
+
+// readShebang returns the interpreter and optional argument of the #! line
+// of a script. ok is false if path is not a script.
+func readShebang(path string) (interp, arg string, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer f.Close()
+	buf := make([]byte, shebangSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", false, err
+	}
+	buf = buf[:n]
+	if !bytes.HasPrefix(buf, []byte("#!")) {
+		return "", "", false, nil
+	}
+	line := string(buf[2:])
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.Trim(line, " \t")
+	if line == "" {
+		return "", "", false, fmt.Errorf("%s: empty #! line", path)
+	}
+	// Like the kernel, pass everything after the interpreter as a single
+	// argument.
+	interp, arg = line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		interp, arg = line[:i], strings.Trim(line[i:], " \t")
+	}
+	return interp, arg, true, nil
+}
+
+// envCommand returns the command env(1) runs given the argument of a
+// "#!/usr/bin/env ..." line, such as "python3" or "-S node --harmony".
+// Options and NAME=VALUE assignments are skipped.
+func envCommand(arg string) string {
+	fields := strings.Fields(arg)
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case f == "-u" || f == "-C" || f == "--unset" || f == "--chdir":
+			// Options with a separate value.
+			i++
+		case strings.HasPrefix(f, "-"), strings.Contains(f, "="):
+		default:
+			return f
+		}
+	}
+	return ""
+}
+
+// lookPath finds an executable named name in the directories of searchPath,
+// like execvp.
+func lookPath(name, searchPath string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(searchPath) {
+		if dir == "" {
+			dir = "."
+		}
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s: executable file not found in %s", name, searchPath)
+}
+
+// Interpreters returns the interpreters the kernel runs to execute path if
+// it is a script: the program of its #! line and, if that is a script too,
+// its own interpreters. For "#!/usr/bin/env NAME" lines, NAME is looked up
+// in searchPath, the PATH of the command, and included as well. The result
+// is empty if path is not a script.
+func Interpreters(path, searchPath string) ([]string, error) {
+	var chain []string
+	seen := map[string]bool{}
+	var follow func(path string, depth int) error
+	follow = func(path string, depth int) error {
+		interp, arg, ok, err := readShebang(path)
+		if err != nil || !ok {
+			return err
+		}
+		if depth == maxInterpreterDepth {
+			return fmt.Errorf("%s: too many levels of #! interpreters", path)
+		}
+		next := []string{interp}
+		if filepath.Base(interp) == "env" {
+			if name := envCommand(arg); name != "" {
+				resolved, err := lookPath(name, searchPath)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				next = append(next, resolved)
+			}
+		}
+		for _, p := range next {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			chain = append(chain, p)
+			if err := follow(p, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := follow(path, 0); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// GetExecutableDependencies returns what executing path requires besides
+// path itself: its interpreters if it is a script (see Interpreters) and the
+// dependencies of every ELF binary among path and its interpreters, see
+// GetDependencies. Interpreters are FoundNeeded.
+func GetExecutableDependencies(path, searchPath string, opts Options) ([]Dependency, error) {
+	interps, err := Interpreters(path, searchPath)
+	if err != nil {
+		return nil, err
+	}
+	out := []Dependency{}
+	index := map[string]int{}
+	add := func(deps ...Dependency) {
+		for _, d := range deps {
+			i, ok := index[d.Path]
+			if !ok {
+				index[d.Path] = len(out)
+				out = append(out, d)
+			} else if !d.Optional() {
+				// Needed by another interpreter.
+				out[i].Found = FoundNeeded
+			}
+		}
+	}
+	for _, interp := range interps {
+		add(Dependency{Path: interp, Found: FoundNeeded})
+	}
+	if len(interps) == 0 {
+		deps, err := GetDependencies(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		add(deps...)
+		return out, nil
+	}
+	for _, exe := range interps {
+		deps, err := GetDependencies(exe, opts)
+		var formatErr *elf.FormatError
+		if errors.As(err, &formatErr) {
+			// A script, whose interpreters are in the chain.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		add(deps...)
+	}
+	return out, nil
+}
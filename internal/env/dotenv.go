@@ -0,0 +1,118 @@
+package env
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Var is a variable defined in an env file.
+type Var struct {
+	Name  string
+	Value string
+	// Expand is set for values in which variable references are expanded:
+	// unquoted and double-quoted ones.
+	Expand bool
+	Line   int
+}
+
+// ParseFile parses a dotenv file: KEY=VALUE lines, optionally prefixed with
+// "export", with # comments and blank lines. Values may be single-quoted
+// (literal), double-quoted (with \n, \t, \", \\ and \$ escapes) or unquoted,
+// in which case surrounding spaces and a trailing " #" comment are removed.
+func ParseFile(name string) ([]Var, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars []Var
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		v.Line = n
+		vars = append(vars, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return vars, nil
+}
+
+func parseLine(line string) (Var, error) {
+	if strings.HasPrefix(line, "export ") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+	}
+	name, value, ok := strings.Cut(line, "=")
+	name = strings.TrimSpace(name)
+	if !ok {
+		return Var{}, fmt.Errorf("expected KEY=VALUE, got %q", line)
+	}
+	if err := validateName(name); err != nil {
+		return Var{}, err
+	}
+	value = strings.TrimSpace(value)
+
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return Var{}, fmt.Errorf("unterminated single-quoted value for %s", name)
+		}
+		if err := checkTrailing(value[end+2:]); err != nil {
+			return Var{}, err
+		}
+		return Var{Name: name, Value: value[1 : end+1]}, nil
+	case strings.HasPrefix(value, `"`):
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch {
+			case c == '"':
+				if err := checkTrailing(value[i+1:]); err != nil {
+					return Var{}, err
+				}
+				return Var{Name: name, Value: b.String(), Expand: true}, nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '$':
+					// Kept escaped from expansion.
+					b.WriteString("$$")
+				default:
+					b.WriteByte(value[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return Var{}, fmt.Errorf("unterminated double-quoted value for %s", name)
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return Var{Name: name, Value: value, Expand: true}, nil
+}
+
+// checkTrailing allows only a comment after a quoted value.
+func checkTrailing(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after quoted value", rest)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package env builds the environment of the sandboxed command from landrun's
+// own environment, presets, env files and explicit variables.
+package env
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zouuup/landrun/internal/log"
+)
+
+// PresetMinimal passes the variables most tools expect.
+const PresetMinimal = "minimal"
+
+// presets maps preset names to the variables they pass from landrun's
+// environment.
+var presets = map[string][]string{
+	PresetMinimal: {"PATH", "HOME", "LANG", "TERM", "TZ"},
+}
+
+// defaultPath is the PATH of the minimal preset when landrun has none.
+const defaultPath = "/usr/local/bin:/usr/bin:/bin"
+
+// ValidatePreset checks an --env-preset value.
+func ValidatePreset(name string) error {
+	if _, ok := presets[name]; ok || name == "" {
+		return nil
+	}
+	return fmt.Errorf("unknown environment preset %q (expected %s)", name, PresetMinimal)
+}
+
+// Spec describes the environment of the command. It is built in this order:
+// the inherited environment, the preset and the variables matching Patterns
+// are taken from landrun's environment, the variables matching Unset are
+// removed from them, and Files and Vars are applied on top.
+type Spec struct {
+	// Inherit passes landrun's whole environment.
+	Inherit bool
+	// Preset is the name of a set of variables to pass, or empty.
+	Preset string
+	// Patterns are glob patterns such as "LC_*" of variables to pass.
+	Patterns []string
+	// Unset are glob patterns of variables not to pass.
+	Unset []string
+	// Files are dotenv files to load, in order.
+	Files []string
+	// Vars are KEY, to pass landrun's value, or KEY=VALUE. Values may
+	// reference variables as $NAME or ${NAME}, which are looked up in the
+	// environment built so far and then in landrun's environment.
+	Vars []string
+	// Strict makes missing KEY variables and undefined references in
+	// values an error instead of a warning.
+	Strict bool
+
+	// Environ and LookupEnv replace os.Environ and os.LookupEnv, for tests.
+	Environ   func() []string
+	LookupEnv func(key string) (string, bool)
+}
+
+// environment is an ordered set of variables.
+type environment struct {
+	names  []string
+	values map[string]string
+}
+
+func (e *environment) set(name, value string) {
+	if _, ok := e.values[name]; !ok {
+		e.names = append(e.names, name)
+	}
+	e.values[name] = value
+}
+
+func (e *environment) remove(match func(name string) bool) {
+	names := e.names[:0]
+	for _, name := range e.names {
+		if match(name) {
+			delete(e.values, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	e.names = names
+}
+
+func (e *environment) list() []string {
+	list := make([]string, 0, len(e.names))
+	for _, name := range e.names {
+		list = append(list, name+"="+e.values[name])
+	}
+	return list
+}
+
+// Build returns the environment described by s, as KEY=VALUE strings.
+func Build(s Spec) ([]string, error) {
+	environ, lookupEnv := s.Environ, s.LookupEnv
+	if environ == nil {
+		environ = os.Environ
+	}
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	if err := ValidatePreset(s.Preset); err != nil {
+		return nil, err
+	}
+	for _, pattern := range append(append([]string{}, s.Patterns...), s.Unset...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid variable pattern %q: %w", pattern, err)
+		}
+	}
+
+	e := &environment{values: map[string]string{}}
+	for _, kv := range environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			continue
+		}
+		if s.Inherit || matchAny(s.Patterns, name) {
+			e.set(name, value)
+		}
+	}
+	for _, name := range presets[s.Preset] {
+		if value, ok := lookupEnv(name); ok {
+			e.set(name, value)
+		} else if name == "PATH" {
+			e.set(name, defaultPath)
+		}
+	}
+	e.remove(func(name string) bool { return matchAny(s.Unset, name) })
+
+	expand := func(value, source string) (string, error) {
+		var undefined []string
+		expanded := os.Expand(value, func(name string) string {
+			if name == "$" {
+				return "$"
+			}
+			if v, ok := e.values[name]; ok {
+				return v
+			}
+			if v, ok := lookupEnv(name); ok {
+				return v
+			}
+			undefined = append(undefined, name)
+			return ""
+		})
+		if len(undefined) > 0 {
+			msg := fmt.Sprintf("%s: undefined variable %s", source, strings.Join(undefined, ", "))
+			if s.Strict {
+				return "", errors.New(msg)
+			}
+			log.Warn("%s", msg)
+		}
+		return expanded, nil
+	}
+
+	for _, file := range s.Files {
+		vars, err := ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vars {
+			value := v.Value
+			if v.Expand {
+				value, err = expand(value, fmt.Sprintf("%s:%d", file, v.Line))
+				if err != nil {
+					return nil, err
+				}
+			}
+			e.set(v.Name, value)
+		}
+	}
+
+	for _, kv := range s.Vars {
+		name, value, ok := strings.Cut(kv, "=")
+		if name == "" {
+			return nil, fmt.Errorf("--env %q: empty variable name", kv)
+		}
+		if !ok {
+			value, ok = lookupEnv(name)
+			if !ok {
+				if s.Strict {
+					return nil, fmt.Errorf("--env %s: variable is not set", name)
+				}
+				log.Warn("Not passing %s: variable is not set", name)
+				continue
+			}
+			e.set(name, value)
+			continue
+		}
+		value, err := expand(value, "--env "+name)
+		if err != nil {
+			return nil, err
+		}
+		e.set(name, value)
+	}
+	return e.list(), nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateName checks a variable name: letters, digits and underscores, not
+// starting with a digit.
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty variable name")
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// WriteText writes the names of the variables in env, without their values
+// which may be secrets.
+func WriteText(w io.Writer, env []string) {
+	fmt.Fprintln(w, "Environment:")
+	if len(env) == 0 {
+		fmt.Fprintln(w, "  empty")
+		return
+	}
+	names := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "  %s\n", strings.Join(names, ", "))
+}
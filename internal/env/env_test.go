@@ -0,0 +1,121 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testEnviron = []string{
+	"PATH=/usr/bin:/bin",
+	"HOME=/home/user",
+	"LANG=C.UTF-8",
+	"LC_ALL=C",
+	"LC_TIME=en_GB",
+	"AWS_SECRET_ACCESS_KEY=secret",
+	"AWS_REGION=eu-west-1",
+	"EDITOR=vi",
+}
+
+func build(t *testing.T, s Spec) ([]string, error) {
+	t.Helper()
+	s.Environ = func() []string { return testEnviron }
+	s.LookupEnv = func(key string) (string, bool) {
+		for _, kv := range testEnviron {
+			if name, value, _ := strings.Cut(kv, "="); name == key {
+				return value, true
+			}
+		}
+		return "", false
+	}
+	return Build(s)
+}
+
+func TestBuild(t *testing.T) {
+	cases := []struct {
+		name string
+		spec Spec
+		want []string
+	}{
+		{"empty", Spec{}, []string{}},
+		{"vars", Spec{Vars: []string{"HOME", "FOO=bar", "MISSING"}}, []string{"HOME=/home/user", "FOO=bar"}},
+		{"expansion", Spec{Vars: []string{"PATH=/opt/bin:${PATH}", "PRICE=$$5"}}, []string{"PATH=/opt/bin:/usr/bin:/bin", "PRICE=$5"}},
+		{"patterns", Spec{Patterns: []string{"LC_*"}}, []string{"LC_ALL=C", "LC_TIME=en_GB"}},
+		{"preset", Spec{Preset: PresetMinimal}, []string{"PATH=/usr/bin:/bin", "HOME=/home/user", "LANG=C.UTF-8"}},
+		{"inherit with unset", Spec{Inherit: true, Unset: []string{"AWS_*", "LC_*"}, Vars: []string{"AWS_REGION"}},
+			[]string{"PATH=/usr/bin:/bin", "HOME=/home/user", "LANG=C.UTF-8", "EDITOR=vi", "AWS_REGION=eu-west-1"}},
+		{"override", Spec{Preset: PresetMinimal, Vars: []string{"HOME=/tmp/home", "PATH=$HOME/bin:$PATH"}},
+			[]string{"PATH=/tmp/home/bin:/usr/bin:/bin", "HOME=/tmp/home", "LANG=C.UTF-8"}},
+	}
+	for _, tc := range cases {
+		got, err := build(t, tc.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	cases := []struct {
+		spec Spec
+		want string
+	}{
+		{Spec{Vars: []string{"MISSING"}, Strict: true}, "--env MISSING: variable is not set"},
+		{Spec{Vars: []string{"X=${UNDEFINED}"}, Strict: true}, "--env X: undefined variable UNDEFINED"},
+		{Spec{Preset: "maximal"}, `unknown environment preset "maximal"`},
+		{Spec{Unset: []string{"AWS_["}}, `invalid variable pattern "AWS_["`},
+		{Spec{Vars: []string{"=value"}}, "empty variable name"},
+	}
+	for _, tc := range cases {
+		if _, err := build(t, tc.spec); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: expected error containing %q, got %v", tc.spec, tc.want, err)
+		}
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".env")
+	content := `# database settings
+DB_HOST=localhost
+export DB_PORT = 5432   # default port
+DB_PASSWORD='p@ss $word'
+GREETING="hello\n\"world\""
+DATA_DIR="${HOME}/data"
+LITERAL="cost: \$5"
+EMPTY=
+`
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := build(t, Spec{Files: []string{file}, Vars: []string{"DB_HOST=db"}})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	want := []string{
+		"DB_HOST=db",
+		"DB_PORT=5432",
+		"DB_PASSWORD=p@ss $word",
+		"GREETING=hello\n\"world\"",
+		"DATA_DIR=/home/user/data",
+		"LITERAL=cost: $5",
+		"EMPTY=",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"NO_EQUALS\n", "1BAD=x\n", "Q=\"unterminated\n", "Q='a' b\n"} {
+		if err := os.WriteFile(file, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := build(t, Spec{Files: []string{file}}); err == nil || !strings.Contains(err.Error(), file+":1:") {
+			t.Errorf("%q: expected an error naming the line, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/zouuup/landrun/internal/sandbox"
+)
+
+// helperFailed is the exit code of a helper that failed to start the
+// command, as for commands that cannot be executed by a shell.
+const helperFailed = 127
+
+// Helper is a helper process started by a program embedding landrun: the
+// child enforces a ruleset on itself and executes the command, leaving the
+// program unrestricted. Unlike Supervise, the caller manages the process
+// through Cmd.
+type Helper struct {
+	// Cmd runs the helper. Callers may set its standard streams, working
+	// directory, environment and SysProcAttr, and may change Path to
+	// another binary handling HelperArg, such as landrun itself.
+	Cmd *exec.Cmd
+}
+
+// NewHelper returns an unstarted helper running the current executable.
+// The process is killed if ctx is done before it exits.
+func NewHelper(ctx context.Context) *Helper {
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{os.Args[0], HelperArg}
+	return &Helper{Cmd: cmd}
+}
+
+// Start starts the helper and waits until it has executed path with args
+// and env under rs and opts. If the helper fails before that, Start waits
+// for it and returns its error.
+func (h *Helper) Start(rs *sandbox.Ruleset, path string, args, env []string, opts Options) error {
+	specR, specW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		specR.Close()
+		specW.Close()
+		return err
+	}
+	h.Cmd.ExtraFiles = []*os.File{specR, errW}
+	err = h.Cmd.Start()
+	specR.Close()
+	errW.Close()
+	if err != nil {
+		specW.Close()
+		errR.Close()
+		return fmt.Errorf("failed to start helper: %w", err)
+	}
+
+	err = json.NewEncoder(specW).Encode(spec{
+		Path:         path,
+		Args:         args,
+		Env:          env,
+		Log:          opts.Log,
+		Ruleset:      rs,
+		Limits:       opts.Limits,
+		Seccomp:      opts.Seccomp,
+		ReportErrors: true,
+	})
+	specW.Close()
+	// The error pipe is closed without data once the command is executed.
+	msg, readErr := io.ReadAll(errR)
+	errR.Close()
+	switch {
+	case err != nil:
+		h.Cmd.Process.Kill()
+		h.Cmd.Wait()
+		return fmt.Errorf("failed to send spec to helper: %w", err)
+	case readErr != nil:
+		h.Cmd.Process.Kill()
+		h.Cmd.Wait()
+		return fmt.Errorf("failed to read helper status: %w", readErr)
+	case len(msg) > 0:
+		h.Cmd.Wait()
+		return errors.New(string(msg))
+	}
+	return nil
+}
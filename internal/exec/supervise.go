@@ -0,0 +1,320 @@
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/zouuup/landrun/internal/log"
+	"github.com/zouuup/landrun/internal/rlimit"
+	"github.com/zouuup/landrun/internal/sandbox"
+	"github.com/zouuup/landrun/internal/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+// HelperArg is the first argument landrun is re-executed with to start a
+// supervised command. The helper reads a spec from specFD, enforces the
+// sandbox on itself and replaces itself with the command.
+const HelperArg = "__landrun-supervised"
+
+// specFD is the file descriptor the helper reads its spec from.
+const specFD = 3
+
+// errorFD is the file descriptor the helper reports failures on when
+// spec.ReportErrors is set. It is closed on exec, so reading nothing from it
+// means the command was started.
+const errorFD = 4
+
+// spec is what the supervisor sends to the helper.
+type spec struct {
+	// Path is the resolved binary to execute; if empty, Args[0] is looked
+	// up in the PATH of the helper.
+	Path    string
+	Args    []string
+	Env     []string
+	Log     log.Options
+	Ruleset *sandbox.Ruleset
+	Limits  []rlimit.Limit
+	Seccomp seccomp.Policy
+
+	ReportErrors bool
+}
+
+// Options controls a supervised run.
+type Options struct {
+	// Path is the resolved binary to execute; if empty, args[0] is looked
+	// up in the PATH.
+	Path string
+	// Log configures the logging of the helper process.
+	Log log.Options
+	// OnExit is a shell command run after the command and its process
+	// group have exited.
+	OnExit string
+	// Limits are the resource limits of the command. landrun itself is
+	// not limited.
+	Limits []rlimit.Limit
+	// Seccomp is the syscall filter of the command.
+	Seccomp seccomp.Policy
+}
+
+// Status is how a supervised command ended.
+type Status struct {
+	// Code is the exit code of the command, or 128 plus the signal number
+	// if it was killed by a signal, as reported by shells.
+	Code int
+	// Signal is the signal that killed the command, if any.
+	Signal syscall.Signal
+
+	// Started and Ended are when the helper was started and when the
+	// command exited.
+	Started, Ended time.Time
+	// Rusage is the resource usage of the command and of the descendants
+	// it waited for.
+	Rusage unix.Rusage
+}
+
+// Supervise runs args sandboxed with rs in a child process and waits for it.
+// Unlike Run, landrun keeps running: signals it receives are forwarded to
+// the command, the terminal is handed to the command while it runs, and the
+// command's process group is killed once the command exits so that no
+// background processes outlive it. The child is killed if landrun dies.
+func Supervise(rs *sandbox.Ruleset, args []string, env []string, opts Options) (Status, error) {
+	// The parent death signal is sent when the thread that started the
+	// child exits, so keep this goroutine on its thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return Status{}, err
+	}
+
+	// Catch signals before the child exists so that none are lost; they
+	// are forwarded once it has started.
+	sigs := make(chan os.Signal, 32)
+	signal.Notify(sigs)
+	defer signal.Stop(sigs)
+
+	s := &supervisor{foreground: ownsTerminal(), sigs: sigs}
+	attr := &syscall.SysProcAttr{
+		Setpgid:    true,
+		Foreground: s.foreground,
+		Ctty:       0,
+		Pdeathsig:  syscall.SIGKILL,
+	}
+	log.Info("Executing: %v", args)
+	started := time.Now()
+	proc, err := os.StartProcess("/proc/self/exe", []string{os.Args[0], HelperArg}, &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, r},
+		Sys:   attr,
+	})
+	r.Close()
+	if err != nil {
+		w.Close()
+		return Status{}, fmt.Errorf("failed to start helper: %w", err)
+	}
+	defer proc.Release()
+	s.pid = proc.Pid
+	log.Debug("Started supervised command with pid %d", s.pid)
+
+	err = json.NewEncoder(w).Encode(spec{Path: opts.Path, Args: args, Env: env, Log: opts.Log, Ruleset: rs, Limits: opts.Limits, Seccomp: opts.Seccomp})
+	w.Close()
+	if err != nil {
+		unix.Kill(s.pid, unix.SIGKILL)
+	}
+
+	done := make(chan struct{})
+	go s.forward(done)
+	ws, ru, waitErr := s.wait()
+	ended := time.Now()
+	close(done)
+
+	// Kill whatever the command left behind in its process group.
+	if err := unix.Kill(-s.pid, unix.SIGKILL); err == nil {
+		log.Debug("Killed remaining processes in group %d", s.pid)
+	}
+	if s.foreground {
+		s.setForeground(unix.Getpgrp())
+	}
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to send spec to helper: %w", err)
+	}
+	if waitErr != nil {
+		return Status{}, waitErr
+	}
+
+	status := Status{Code: ws.ExitStatus(), Started: started, Ended: ended, Rusage: ru}
+	if ws.Signaled() {
+		status.Code, status.Signal = 128+int(ws.Signal()), ws.Signal()
+		log.Info("Command killed by signal %v", ws.Signal())
+	} else {
+		log.Info("Command exited with code %d", status.Code)
+	}
+
+	if opts.OnExit != "" {
+		runOnExit(opts.OnExit, s.pid, status)
+	}
+	return status, nil
+}
+
+// supervisor tracks a running supervised command.
+type supervisor struct {
+	pid int
+	// foreground is set while the command's process group owns the
+	// controlling terminal.
+	foreground bool
+	sigs       chan os.Signal
+}
+
+// forward relays the signals landrun receives to the command until done is
+// closed. Signals about landrun's own children and terminal access are not
+// forwarded, nor is SIGCONT, which wait sends itself once the terminal has
+// been handed back.
+func (s *supervisor) forward(done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case sig := <-s.sigs:
+			switch sig {
+			case unix.SIGCHLD, unix.SIGURG, unix.SIGPIPE, unix.SIGTTIN, unix.SIGTTOU, unix.SIGCONT:
+				continue
+			}
+			log.Debug("Forwarding %v to pid %d", sig, s.pid)
+			unix.Kill(s.pid, sig.(syscall.Signal))
+		}
+	}
+}
+
+// wait waits for the command to exit. When the command is stopped, for
+// example with ^Z, landrun stops as well so that the shell sees the job as
+// stopped, and continues the command when it is continued itself.
+func (s *supervisor) wait() (unix.WaitStatus, unix.Rusage, error) {
+	for {
+		var ws unix.WaitStatus
+		var ru unix.Rusage
+		_, err := unix.Wait4(s.pid, &ws, unix.WUNTRACED, &ru)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return ws, ru, fmt.Errorf("wait4: %w", err)
+		}
+		if !ws.Stopped() {
+			return ws, ru, nil
+		}
+
+		log.Debug("Command stopped by %v", ws.StopSignal())
+		if s.foreground {
+			s.setForeground(unix.Getpgrp())
+		}
+		unix.Kill(unix.Getpid(), unix.SIGSTOP)
+		// Only take the terminal back if the shell continued the job in
+		// the foreground.
+		s.foreground = ownsTerminal()
+		if s.foreground {
+			s.setForeground(s.pid)
+		}
+		unix.Kill(-s.pid, unix.SIGCONT)
+	}
+}
+
+// setForeground makes pgrp the foreground process group of the terminal.
+// SIGTTOU is ignored meanwhile since landrun is in the background.
+func (s *supervisor) setForeground(pgrp int) {
+	signal.Ignore(unix.SIGTTOU)
+	if err := unix.IoctlSetPointerInt(0, unix.TIOCSPGRP, pgrp); err != nil {
+		log.Debug("Failed to set the terminal foreground process group: %v", err)
+	}
+	signal.Notify(s.sigs, unix.SIGTTOU)
+}
+
+// ownsTerminal reports whether landrun is in the foreground process group
+// of the terminal on its standard input.
+func ownsTerminal() bool {
+	pgrp, err := unix.IoctlGetInt(0, unix.TIOCGPGRP)
+	return err == nil && pgrp == unix.Getpgrp()
+}
+
+// runOnExit runs the --on-exit command outside the sandbox with the status
+// of the command in its environment.
+func runOnExit(command string, pid int, status Status) {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("LANDRUN_EXIT_CODE=%d", status.Code),
+		fmt.Sprintf("LANDRUN_PID=%d", pid),
+	)
+	if status.Signal != 0 {
+		cmd.Env = append(cmd.Env, "LANDRUN_EXIT_SIGNAL="+unix.SignalName(status.Signal))
+	}
+	log.Debug("Running on-exit command: %s", command)
+	if err := cmd.Run(); err != nil {
+		log.Warn("On-exit command failed: %v", err)
+	}
+}
+
+// Exit exits landrun with status: with the same exit code, or by the same
+// signal if the command was killed by one.
+func (s Status) Exit() {
+	if s.Signal != 0 {
+		// The Go runtime handles every signal itself, so restore the
+		// default action directly. A zeroed struct sigaction is SIG_DFL on
+		// every architecture. Don't dump core for landrun itself.
+		var act [4]uint64
+		unix.RawSyscall6(unix.SYS_RT_SIGACTION, uintptr(s.Signal), uintptr(unsafe.Pointer(&act)), 0, 8, 0, 0)
+		unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{})
+		unix.Tgkill(unix.Getpid(), unix.Gettid(), s.Signal)
+	}
+	os.Exit(s.Code)
+}
+
+// RunHelper is the entry point of the helper process started by Supervise.
+// It never returns.
+func RunHelper() {
+	f := os.NewFile(specFD, "spec")
+	var s spec
+	err := json.NewDecoder(f).Decode(&s)
+	f.Close()
+	if err != nil {
+		log.Fatal("Failed to read the supervised command from landrun: %v", err)
+	}
+
+	fatal := log.Fatal
+	if s.ReportErrors {
+		unix.CloseOnExec(errorFD)
+		fatal = func(format string, v ...interface{}) {
+			unix.Write(errorFD, []byte(fmt.Sprintf(format, v...)))
+			os.Exit(helperFailed)
+		}
+	}
+	// The log file and syslog connection are opened before the sandbox is
+	// enforced, and closed when the command is executed.
+	if err := log.Configure(s.Log); err != nil {
+		fatal("Failed to configure logging: %v", err)
+	}
+
+	if err := sandbox.Enforce(s.Ruleset); err != nil {
+		fatal("Failed to apply sandbox: %v", err)
+	}
+	if err := rlimit.Apply(s.Limits); err != nil {
+		fatal("Failed to apply resource limits: %v", err)
+	}
+	if err := seccomp.Install(s.Seccomp); err != nil {
+		fatal("Failed to install seccomp filter: %v", err)
+	}
+	if s.Path != "" {
+		log.Info("Executing: %v", s.Args)
+		err = syscall.Exec(s.Path, s.Args, s.Env)
+	} else {
+		err = Run(s.Args, s.Env)
+	}
+	fatal("%v", err)
+}
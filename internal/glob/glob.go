@@ -0,0 +1,102 @@
+// Package glob expands shell-style path patterns. In addition to the
+// filepath.Match syntax, a "**" path component matches any number of
+// directories, including none.
+package glob
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IsPattern reports whether path contains glob metacharacters.
+func IsPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// Expand returns the existing paths matching pattern, sorted. A pattern
+// without metacharacters, or naming an existing file literally, is returned
+// as is. Wildcards match names starting with a dot, and "**" does not follow
+// symlinks to directories.
+func Expand(pattern string) ([]string, error) {
+	if !IsPattern(pattern) {
+		return []string{pattern}, nil
+	}
+	if _, err := os.Lstat(pattern); err == nil {
+		return []string{pattern}, nil
+	}
+	// Validate the syntax of every component up front so that a bad pattern
+	// is reported even if nothing exists to match against.
+	for _, c := range strings.Split(pattern, "/") {
+		if c == "**" {
+			continue
+		}
+		if _, err := filepath.Match(c, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	base := "."
+	rest := pattern
+	if filepath.IsAbs(pattern) {
+		base = "/"
+		rest = strings.TrimLeft(pattern, "/")
+	}
+	var parts []string
+	for _, c := range strings.Split(rest, "/") {
+		if c != "" && c != "." {
+			parts = append(parts, c)
+		}
+	}
+
+	seen := map[string]bool{}
+	var matches []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			matches = append(matches, path)
+		}
+	}
+	expand(base, parts, add)
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// expand matches the remaining components parts below dir.
+func expand(dir string, parts []string, add func(string)) {
+	if len(parts) == 0 {
+		if _, err := os.Lstat(dir); err == nil {
+			add(dir)
+		}
+		return
+	}
+	part, rest := parts[0], parts[1:]
+
+	switch {
+	case part == "**":
+		// Zero directories, then one more level with "**" still pending.
+		expand(dir, rest, add)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				expand(filepath.Join(dir, e.Name()), parts, add)
+			}
+		}
+	case !IsPattern(part):
+		expand(filepath.Join(dir, part), rest, add)
+	default:
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if ok, _ := filepath.Match(part, e.Name()); ok {
+				expand(filepath.Join(dir, e.Name()), rest, add)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package glob
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{
+		"ssl/certs/a.pem",
+		"ssl/certs/b.crt",
+		"ssl/private/deep/c.pem",
+		"ssl/d.pem",
+		"lib/python3.11/os.py",
+		"lib/python3.12/os.py",
+		"lib/python2.7/os.py",
+	} {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "odd[1]"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		pattern string
+		want    []string
+	}{
+		{"ssl/**/*.pem", []string{"ssl/certs/a.pem", "ssl/d.pem", "ssl/private/deep/c.pem"}},
+		{"lib/python3.*", []string{"lib/python3.11", "lib/python3.12"}},
+		{"lib/python?.*/os.py", []string{"lib/python2.7/os.py", "lib/python3.11/os.py", "lib/python3.12/os.py"}},
+		{"ssl/certs/*.key", nil},
+		{"odd[1]", []string{"odd[1]"}},
+		{"ssl/certs", []string{"ssl/certs"}},
+	}
+	for _, tc := range cases {
+		got, err := Expand(filepath.Join(root, tc.pattern))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.pattern, err)
+		}
+		var want []string
+		for _, w := range tc.want {
+			want = append(want, filepath.Join(root, w))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", tc.pattern, got, want)
+		}
+	}
+
+	if _, err := Expand(filepath.Join(root, "[-")); err == nil {
+		t.Errorf("expected an error for a malformed pattern")
+	}
+}
@@ -0,0 +1,175 @@
+package learn
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zouuup/landrun/internal/profile"
+)
+
+// class is a landrun path class expressed as read, write and execute bits,
+// so that joining two classes is a bitwise or.
+type class uint8
+
+const (
+	classRead class = 1 << iota
+	classWrite
+	classExec
+
+	classRO  = classRead
+	classROX = classRead | classExec
+	classRW  = classRead | classWrite
+	classRWX = classRead | classWrite | classExec
+)
+
+// covers reports whether a rule of class c grants everything b needs.
+func (c class) covers(b class) bool {
+	return c&b == b
+}
+
+// Profile turns the observation into a profile. Files of the same class in
+// one directory are replaced by a rule for the directory once at least
+// collapse of them were seen; zero disables collapsing.
+func (o *Observation) Profile(collapse int) *profile.Profile {
+	entries := map[string]class{}
+	for path, a := range o.Paths {
+		path = normalize(path)
+		if path == "" {
+			continue
+		}
+		entries[path] |= classify(path, a)
+	}
+
+	if collapse > 0 {
+		collapseDirs(entries, collapse)
+	}
+	pruneCovered(entries)
+
+	p := &profile.Profile{}
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		switch entries[path] {
+		case classRO:
+			p.ReadOnlyPaths = append(p.ReadOnlyPaths, path)
+		case classROX:
+			p.ReadOnlyExecutablePaths = append(p.ReadOnlyExecutablePaths, path)
+		case classRW:
+			p.ReadWritePaths = append(p.ReadWritePaths, path)
+		default:
+			p.ReadWriteExecutablePaths = append(p.ReadWriteExecutablePaths, path)
+		}
+	}
+	p.BindTCPPorts = sortedPorts(o.BindPorts)
+	p.ConnectTCPPorts = sortedPorts(o.ConnectPorts)
+	return p
+}
+
+// sharedLibrary matches file names like libc.so.6 or ld-linux-x86-64.so.2.
+var sharedLibrary = regexp.MustCompile(`\.so(\.[0-9]+)*$`)
+
+// classify maps observed accesses on a path to a landrun class. Shared
+// libraries are loaded with PROT_EXEC and get execute access.
+func classify(path string, a Access) class {
+	var c class
+	if a&(AccessRead|AccessExec) != 0 {
+		c |= classRead
+	}
+	if a&(AccessWrite|AccessDirWrite) != 0 {
+		c |= classRW
+	}
+	if a&AccessExec != 0 || isSharedLibrary(path) {
+		c |= classExec
+	}
+	return c
+}
+
+func isSharedLibrary(path string) bool {
+	return sharedLibrary.MatchString(filepath.Base(path))
+}
+
+// normalize maps paths that differ between runs to stable rules and drops
+// entries that cannot be expressed as Landlock rules.
+func normalize(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/memfd:"), strings.HasSuffix(path, " (deleted)"):
+		return ""
+	case strings.HasPrefix(path, "/proc/"):
+		// Per-process entries change with every run.
+		parts := strings.SplitN(strings.TrimPrefix(path, "/proc/"), "/", 2)
+		if procPID(parts[0]) || parts[0] == "self" || parts[0] == "thread-self" {
+			return "/proc"
+		}
+	case strings.HasPrefix(path, "/dev/pts/"):
+		return "/dev/pts"
+	}
+	return path
+}
+
+// collapseDirs replaces files of the same class in a directory with a single
+// rule for the directory when there are at least threshold of them.
+func collapseDirs(entries map[string]class, threshold int) {
+	groups := map[string]map[class][]string{}
+	for path, c := range entries {
+		if isDir(path) {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if groups[dir] == nil {
+			groups[dir] = map[class][]string{}
+		}
+		groups[dir][c] = append(groups[dir][c], path)
+	}
+	for dir, byClass := range groups {
+		if dir == "/" {
+			continue
+		}
+		for c, files := range byClass {
+			if len(files) < threshold {
+				continue
+			}
+			for _, f := range files {
+				delete(entries, f)
+			}
+			entries[dir] |= c
+		}
+	}
+}
+
+// pruneCovered drops entries already granted by a rule on a parent directory.
+func pruneCovered(entries map[string]class) {
+	for path, c := range entries {
+		if path == "/" {
+			continue
+		}
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			if parent, ok := entries[dir]; ok && isDir(dir) && parent.covers(c) {
+				delete(entries, path)
+				break
+			}
+			if dir == "/" {
+				break
+			}
+		}
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func sortedPorts(ports map[int]bool) []int {
+	out := make([]int, 0, len(ports))
+	for port := range ports {
+		out = append(out, port)
+	}
+	sort.Ints(out)
+	return out
+}
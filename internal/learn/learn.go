@@ -0,0 +1,447 @@
+// Package learn traces a command with ptrace and derives a sandbox profile
+// from the files it opens, executes, creates or removes and the TCP ports it
+// binds or connects to.
+package learn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"github.com/zouuup/landrun/internal/log"
+	"golang.org/x/sys/unix"
+)
+
+// Access is a set of operations observed on a path.
+type Access uint8
+
+const (
+	AccessRead Access = 1 << iota
+	AccessWrite
+	AccessExec
+	// AccessDirWrite means entries were created or removed in a directory.
+	AccessDirWrite
+)
+
+// Observation is what a traced command did.
+type Observation struct {
+	Paths        map[string]Access
+	BindPorts    map[int]bool
+	ConnectPorts map[int]bool
+	// ExitCode is the exit code of the traced command, or 128 plus the
+	// signal number if it was killed by a signal.
+	ExitCode int
+}
+
+func newObservation() *Observation {
+	return &Observation{
+		Paths:        map[string]Access{},
+		BindPorts:    map[int]bool{},
+		ConnectPorts: map[int]bool{},
+	}
+}
+
+func (o *Observation) addPath(path string, a Access) {
+	if path == "" || !filepath.IsAbs(path) {
+		return
+	}
+	o.Paths[filepath.Clean(path)] |= a
+}
+
+// effect describes what a syscall does with one of its path arguments.
+type effect int
+
+const (
+	effectOpen effect = iota
+	effectExec
+	effectWrite
+	effectCreate
+	effectCreateFile
+	effectRemove
+)
+
+// netOp identifies the socket syscalls that Landlock restricts.
+type netOp int
+
+const (
+	netNone netOp = iota
+	netBind
+	netConnect
+)
+
+// pathArg locates a path argument, optionally relative to a directory file
+// descriptor argument (dirfd -1 means the working directory).
+type pathArg struct {
+	dirfd  int
+	path   int
+	effect effect
+}
+
+// spec describes the arguments of a traced syscall. flags and how are
+// argument indexes of open flags and of the openat2 struct open_how; zero is
+// never a valid index for either.
+type spec struct {
+	paths []pathArg
+	flags int
+	how   int
+	net   netOp
+}
+
+// pending holds what was decoded at syscall entry until the syscall returns.
+type pending struct {
+	spec    spec
+	paths   []string
+	flags   uint64
+	existed []bool
+	port    int
+	tcp     bool
+}
+
+// atFDCWD is the dirfd value meaning "relative to the working directory".
+const atFDCWD = -100
+
+// Trace runs the command unsandboxed under ptrace, following all child
+// processes and threads, and records the accesses it makes.
+func Trace(args []string, env []string) (*Observation, error) {
+	if len(syscalls) == 0 {
+		return nil, fmt.Errorf("learn mode is not supported on %s", runtime.GOARCH)
+	}
+	binary, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// All ptrace requests must come from the thread that started the tracee.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cmd := exec.Command(binary, args[1:]...)
+	cmd.Args = args
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	t := &tracer{
+		obs:       newObservation(),
+		root:      cmd.Process.Pid,
+		inSyscall: map[int]bool{},
+		calls:     map[int]*pending{},
+	}
+	t.obs.addPath(binary, AccessExec)
+	if err := t.run(); err != nil {
+		return nil, err
+	}
+	return t.obs, nil
+}
+
+type tracer struct {
+	obs       *Observation
+	root      int
+	inSyscall map[int]bool
+	calls     map[int]*pending
+}
+
+const traceOptions = syscall.PTRACE_O_TRACESYSGOOD |
+	syscall.PTRACE_O_TRACEFORK |
+	syscall.PTRACE_O_TRACEVFORK |
+	syscall.PTRACE_O_TRACECLONE |
+	syscall.PTRACE_O_TRACEEXEC |
+	unix.PTRACE_O_EXITKILL
+
+// run waits for tracee stops until all traced processes have exited.
+func (t *tracer) run() error {
+	// The tracee stops with SIGTRAP after its initial execve.
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(t.root, &status, 0, nil); err != nil {
+		return fmt.Errorf("wait for traced command: %w", err)
+	}
+	if err := syscall.PtraceSetOptions(t.root, traceOptions); err != nil {
+		return fmt.Errorf("ptrace: %w", err)
+	}
+	if err := syscall.PtraceSyscall(t.root, 0); err != nil {
+		return fmt.Errorf("ptrace: %w", err)
+	}
+
+	known := map[int]bool{t.root: true}
+	for {
+		pid, err := syscall.Wait4(-1, &status, syscall.WALL, nil)
+		if errors.Is(err, syscall.ECHILD) {
+			return nil
+		}
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("wait for traced command: %w", err)
+		}
+
+		switch {
+		case status.Exited() || status.Signaled():
+			if pid == t.root {
+				if status.Exited() {
+					t.obs.ExitCode = status.ExitStatus()
+				} else {
+					t.obs.ExitCode = 128 + int(status.Signal())
+				}
+			}
+			delete(t.inSyscall, pid)
+			delete(t.calls, pid)
+			delete(known, pid)
+			continue
+
+		case !status.Stopped():
+			continue
+		}
+
+		sig := 0
+		switch stop := status.StopSignal(); {
+		case stop == syscall.SIGTRAP|0x80:
+			t.syscallStop(pid)
+		case stop == syscall.SIGTRAP && status.TrapCause() != 0:
+			// fork, clone and exec events; new children are traced
+			// automatically and announce themselves with SIGSTOP.
+			if status.TrapCause() == syscall.PTRACE_EVENT_EXEC {
+				if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+					t.obs.addPath(exe, AccessExec)
+				}
+			}
+		case stop == syscall.SIGSTOP && !known[pid]:
+			known[pid] = true
+		default:
+			sig = int(stop)
+		}
+
+		if err := syscall.PtraceSyscall(pid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+			log.Debug("ptrace(PTRACE_SYSCALL, %d): %v", pid, err)
+		}
+	}
+}
+
+// syscallStop handles a syscall-entry or syscall-exit stop of pid.
+func (t *tracer) syscallStop(pid int) {
+	if !t.inSyscall[pid] {
+		t.inSyscall[pid] = true
+		nr, args, err := readRegs(pid)
+		if err != nil {
+			return
+		}
+		if s, ok := syscalls[nr]; ok {
+			t.calls[pid] = t.decode(pid, s, args)
+		}
+		return
+	}
+
+	t.inSyscall[pid] = false
+	call := t.calls[pid]
+	delete(t.calls, pid)
+	if call == nil {
+		return
+	}
+	ret, err := readReturn(pid)
+	if err != nil {
+		return
+	}
+	if ret < 0 && !(call.spec.net == netConnect && syscall.Errno(-ret) == syscall.EINPROGRESS) {
+		return
+	}
+	t.record(pid, call, ret)
+}
+
+// decode reads the arguments of a syscall at entry.
+func (t *tracer) decode(pid int, s spec, args [6]uint64) *pending {
+	call := &pending{spec: s}
+	for _, pa := range s.paths {
+		path := readString(pid, uintptr(args[pa.path]))
+		dirfd := atFDCWD
+		if pa.dirfd >= 0 {
+			dirfd = int(int32(args[pa.dirfd]))
+		}
+		path = resolve(pid, dirfd, path)
+		_, err := os.Lstat(path)
+		call.paths = append(call.paths, path)
+		call.existed = append(call.existed, err == nil)
+	}
+	switch {
+	case s.flags > 0:
+		call.flags = args[s.flags]
+	case s.how > 0:
+		// struct open_how starts with the 64-bit open flags.
+		buf := make([]byte, 8)
+		if n, _ := syscall.PtracePeekData(pid, uintptr(args[s.how]), buf); n == len(buf) {
+			call.flags = binary.LittleEndian.Uint64(buf)
+		}
+	}
+	if s.net != netNone {
+		call.port, call.tcp = readTCPAddr(pid, int(int32(args[0])), uintptr(args[1]), int(args[2]))
+	}
+	return call
+}
+
+// record adds the effects of a successful syscall to the observation.
+func (t *tracer) record(pid int, call *pending, ret int64) {
+	switch call.spec.net {
+	case netBind:
+		if call.tcp {
+			t.obs.BindPorts[call.port] = true
+		}
+		return
+	case netConnect:
+		if call.tcp {
+			t.obs.ConnectPorts[call.port] = true
+		}
+		return
+	}
+
+	for i, pa := range call.spec.paths {
+		path := call.paths[i]
+		switch pa.effect {
+		case effectOpen:
+			if call.flags&unix.O_PATH != 0 {
+				// O_PATH descriptors are not subject to Landlock.
+				continue
+			}
+			if fdPath, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, ret)); err == nil {
+				path = fdPath
+			}
+			var a Access
+			switch call.flags & syscall.O_ACCMODE {
+			case syscall.O_RDONLY:
+				a = AccessRead
+			case syscall.O_WRONLY:
+				a = AccessWrite
+			default:
+				a = AccessRead | AccessWrite
+			}
+			if call.flags&syscall.O_TRUNC != 0 {
+				a |= AccessWrite
+			}
+			if call.flags&syscall.O_CREAT != 0 && !call.existed[i] {
+				t.obs.addPath(realDir(path), AccessDirWrite)
+			}
+			t.obs.addPath(path, a)
+		case effectExec:
+			t.obs.addPath(realPath(path), AccessExec|AccessRead)
+		case effectWrite:
+			t.obs.addPath(realPath(path), AccessWrite)
+		case effectCreateFile:
+			if !call.existed[i] {
+				t.obs.addPath(realDir(path), AccessDirWrite)
+			}
+			t.obs.addPath(realPath(path), AccessWrite)
+		case effectCreate, effectRemove:
+			t.obs.addPath(realDir(path), AccessDirWrite)
+		}
+	}
+}
+
+// resolve makes path absolute using the tracee's working directory or the
+// directory behind dirfd.
+func resolve(pid, dirfd int, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	link := fmt.Sprintf("/proc/%d/cwd", pid)
+	if dirfd != atFDCWD {
+		link = fmt.Sprintf("/proc/%d/fd/%d", pid, dirfd)
+	}
+	dir, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, path)
+}
+
+// realPath resolves symlinks in path, since Landlock rules apply to the
+// file a symlink points to.
+func realPath(path string) string {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		return p
+	}
+	return path
+}
+
+// realDir returns the resolved parent directory of path.
+func realDir(path string) string {
+	return realPath(filepath.Dir(path))
+}
+
+// readString reads a NUL terminated string from the tracee's memory.
+func readString(pid int, addr uintptr) string {
+	if addr == 0 {
+		return ""
+	}
+	var out []byte
+	buf := make([]byte, 256)
+	for len(out) < syscall.PathMax {
+		n, err := syscall.PtracePeekData(pid, addr, buf)
+		for i := 0; i < n; i++ {
+			if buf[i] == 0 {
+				return string(append(out, buf[:i]...))
+			}
+		}
+		out = append(out, buf[:n]...)
+		if err != nil || n == 0 {
+			break
+		}
+		addr += uintptr(n)
+	}
+	return string(out)
+}
+
+// readTCPAddr decodes the port of an IPv4 or IPv6 socket address passed to
+// bind or connect and reports whether the socket is a TCP socket.
+func readTCPAddr(pid, fd int, addr uintptr, addrLen int) (port int, tcp bool) {
+	if addr == 0 || addrLen < 4 {
+		return 0, false
+	}
+	buf := make([]byte, 4)
+	if n, _ := syscall.PtracePeekData(pid, addr, buf); n != len(buf) {
+		return 0, false
+	}
+	family := binary.LittleEndian.Uint16(buf[0:2])
+	if family != syscall.AF_INET && family != syscall.AF_INET6 {
+		return 0, false
+	}
+	port = int(binary.BigEndian.Uint16(buf[2:4]))
+	return port, isTCPSocket(pid, fd)
+}
+
+// isTCPSocket reports whether fd of the tracee is a TCP socket. The socket
+// is duplicated into landrun with pidfd_getfd to query its type; if that is
+// not possible any stream socket is assumed to be TCP.
+func isTCPSocket(pid, fd int) bool {
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return true
+	}
+	defer unix.Close(pidfd)
+	sock, err := unix.PidfdGetfd(pidfd, fd, 0)
+	if err != nil {
+		return true
+	}
+	defer unix.Close(sock)
+
+	typ, err := unix.GetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_TYPE)
+	if err != nil || typ != unix.SOCK_STREAM {
+		return false
+	}
+	proto, err := unix.GetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_PROTOCOL)
+	return err != nil || proto == unix.IPPROTO_TCP
+}
+
+// procPID reports whether name is a process directory under /proc.
+func procPID(name string) bool {
+	_, err := strconv.Atoi(name)
+	return err == nil
+}
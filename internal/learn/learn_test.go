@@ -0,0 +1,84 @@
+package learn
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProfileClassifiesAndCollapses(t *testing.T) {
+	dir := t.TempDir()
+	libs := filepath.Join(dir, "lib")
+	data := filepath.Join(dir, "data")
+	spool := filepath.Join(dir, "spool")
+	for _, d := range []string{libs, data, spool} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+
+	obs := newObservation()
+	obs.addPath(filepath.Join(libs, "liba.so.1"), AccessRead)
+	obs.addPath(filepath.Join(libs, "libb.so"), AccessRead)
+	obs.addPath(filepath.Join(libs, "libc.so.6"), AccessRead)
+	obs.addPath(filepath.Join(data, "config.ini"), AccessRead)
+	obs.addPath(filepath.Join(data, "ld.so.cache"), AccessRead)
+	obs.addPath(filepath.Join(data, "out.log"), AccessWrite)
+	obs.addPath(spool, AccessDirWrite)
+	obs.addPath(filepath.Join(spool, "job"), AccessRead|AccessWrite)
+	obs.addPath("/proc/1234/status", AccessRead)
+	obs.addPath("/proc/self/maps", AccessRead)
+	obs.ConnectPorts[443] = true
+	obs.BindPorts[8080] = true
+
+	p := obs.Profile(3)
+
+	wantRO := []string{"/proc", filepath.Join(data, "config.ini"), filepath.Join(data, "ld.so.cache")}
+	if !reflect.DeepEqual(p.ReadOnlyPaths, wantRO) {
+		t.Errorf("ro = %v, want %v", p.ReadOnlyPaths, wantRO)
+	}
+	if !reflect.DeepEqual(p.ReadOnlyExecutablePaths, []string{libs}) {
+		t.Errorf("rox = %v, want the collapsed library directory", p.ReadOnlyExecutablePaths)
+	}
+	wantRW := []string{filepath.Join(data, "out.log"), spool}
+	if !reflect.DeepEqual(p.ReadWritePaths, wantRW) {
+		t.Errorf("rw = %v, want %v", p.ReadWritePaths, wantRW)
+	}
+	if !reflect.DeepEqual(p.ConnectTCPPorts, []int{443}) || !reflect.DeepEqual(p.BindTCPPorts, []int{8080}) {
+		t.Errorf("unexpected ports %v %v", p.BindTCPPorts, p.ConnectTCPPorts)
+	}
+
+	noCollapse := obs.Profile(0)
+	if len(noCollapse.ReadOnlyExecutablePaths) != 3 {
+		t.Errorf("expected individual libraries without collapsing, got %v", noCollapse.ReadOnlyExecutablePaths)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	if len(syscalls) == 0 {
+		t.Skip("learn mode not supported on this architecture")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	dir := t.TempDir()
+	script := "cat /etc/passwd > /dev/null; touch " + filepath.Join(dir, "created") + "; exit 3"
+
+	obs, err := Trace([]string{sh, "-c", script}, nil)
+	if err != nil {
+		t.Skipf("ptrace not available: %v", err)
+	}
+	if obs.ExitCode != 3 {
+		t.Errorf("exit code = %d, want 3", obs.ExitCode)
+	}
+	if obs.Paths["/etc/passwd"]&AccessRead == 0 {
+		t.Errorf("read of /etc/passwd not recorded: %v", obs.Paths)
+	}
+	realDir, _ := filepath.EvalSymlinks(dir)
+	if obs.Paths[realDir]&AccessDirWrite == 0 {
+		t.Errorf("file creation in %s not recorded: %v", realDir, obs.Paths)
+	}
+}
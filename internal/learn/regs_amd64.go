@@ -0,0 +1,54 @@
+package learn
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// syscalls maps the syscall numbers of this architecture to the way their
+// arguments are interpreted.
+var syscalls = map[uint64]spec{
+	unix.SYS_OPEN:      {paths: []pathArg{{dirfd: -1, path: 0, effect: effectOpen}}, flags: 1},
+	unix.SYS_OPENAT:    {paths: []pathArg{{dirfd: 0, path: 1, effect: effectOpen}}, flags: 2},
+	unix.SYS_OPENAT2:   {paths: []pathArg{{dirfd: 0, path: 1, effect: effectOpen}}, how: 2},
+	unix.SYS_CREAT:     {paths: []pathArg{{dirfd: -1, path: 0, effect: effectCreateFile}}},
+	unix.SYS_EXECVE:    {paths: []pathArg{{dirfd: -1, path: 0, effect: effectExec}}},
+	unix.SYS_EXECVEAT:  {paths: []pathArg{{dirfd: 0, path: 1, effect: effectExec}}},
+	unix.SYS_TRUNCATE:  {paths: []pathArg{{dirfd: -1, path: 0, effect: effectWrite}}},
+	unix.SYS_MKDIR:     {paths: []pathArg{{dirfd: -1, path: 0, effect: effectCreate}}},
+	unix.SYS_MKDIRAT:   {paths: []pathArg{{dirfd: 0, path: 1, effect: effectCreate}}},
+	unix.SYS_MKNOD:     {paths: []pathArg{{dirfd: -1, path: 0, effect: effectCreate}}},
+	unix.SYS_MKNODAT:   {paths: []pathArg{{dirfd: 0, path: 1, effect: effectCreate}}},
+	unix.SYS_SYMLINK:   {paths: []pathArg{{dirfd: -1, path: 1, effect: effectCreate}}},
+	unix.SYS_SYMLINKAT: {paths: []pathArg{{dirfd: 1, path: 2, effect: effectCreate}}},
+	unix.SYS_LINK:      {paths: []pathArg{{dirfd: -1, path: 1, effect: effectCreate}}},
+	unix.SYS_LINKAT:    {paths: []pathArg{{dirfd: 2, path: 3, effect: effectCreate}}},
+	unix.SYS_UNLINK:    {paths: []pathArg{{dirfd: -1, path: 0, effect: effectRemove}}},
+	unix.SYS_UNLINKAT:  {paths: []pathArg{{dirfd: 0, path: 1, effect: effectRemove}}},
+	unix.SYS_RMDIR:     {paths: []pathArg{{dirfd: -1, path: 0, effect: effectRemove}}},
+	unix.SYS_RENAME:    {paths: []pathArg{{dirfd: -1, path: 0, effect: effectRemove}, {dirfd: -1, path: 1, effect: effectCreate}}},
+	unix.SYS_RENAMEAT:  {paths: []pathArg{{dirfd: 0, path: 1, effect: effectRemove}, {dirfd: 2, path: 3, effect: effectCreate}}},
+	unix.SYS_RENAMEAT2: {paths: []pathArg{{dirfd: 0, path: 1, effect: effectRemove}, {dirfd: 2, path: 3, effect: effectCreate}}},
+	unix.SYS_BIND:      {net: netBind},
+	unix.SYS_CONNECT:   {net: netConnect},
+}
+
+// readRegs returns the syscall number and arguments at a syscall-entry stop.
+func readRegs(pid int) (nr uint64, args [6]uint64, err error) {
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(pid, &regs); err != nil {
+		return 0, args, err
+	}
+	args = [6]uint64{regs.Rdi, regs.Rsi, regs.Rdx, regs.R10, regs.R8, regs.R9}
+	return regs.Orig_rax, args, nil
+}
+
+// readReturn returns the syscall result at a syscall-exit stop.
+func readReturn(pid int) (int64, error) {
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(pid, &regs); err != nil {
+		return 0, err
+	}
+	return int64(regs.Rax), nil
+}
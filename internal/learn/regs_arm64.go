@@ -0,0 +1,46 @@
+package learn
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// ntPrstatus selects the general purpose registers in PTRACE_GETREGSET.
+const ntPrstatus = 1
+
+// syscalls maps the syscall numbers of this architecture to the way their
+// arguments are interpreted. arm64 only has the *at variants.
+var syscalls = map[uint64]spec{
+	unix.SYS_OPENAT:    {paths: []pathArg{{dirfd: 0, path: 1, effect: effectOpen}}, flags: 2},
+	unix.SYS_OPENAT2:   {paths: []pathArg{{dirfd: 0, path: 1, effect: effectOpen}}, how: 2},
+	unix.SYS_EXECVE:    {paths: []pathArg{{dirfd: -1, path: 0, effect: effectExec}}},
+	unix.SYS_EXECVEAT:  {paths: []pathArg{{dirfd: 0, path: 1, effect: effectExec}}},
+	unix.SYS_TRUNCATE:  {paths: []pathArg{{dirfd: -1, path: 0, effect: effectWrite}}},
+	unix.SYS_MKDIRAT:   {paths: []pathArg{{dirfd: 0, path: 1, effect: effectCreate}}},
+	unix.SYS_MKNODAT:   {paths: []pathArg{{dirfd: 0, path: 1, effect: effectCreate}}},
+	unix.SYS_SYMLINKAT: {paths: []pathArg{{dirfd: 1, path: 2, effect: effectCreate}}},
+	unix.SYS_LINKAT:    {paths: []pathArg{{dirfd: 2, path: 3, effect: effectCreate}}},
+	unix.SYS_UNLINKAT:  {paths: []pathArg{{dirfd: 0, path: 1, effect: effectRemove}}},
+	unix.SYS_RENAMEAT:  {paths: []pathArg{{dirfd: 0, path: 1, effect: effectRemove}, {dirfd: 2, path: 3, effect: effectCreate}}},
+	unix.SYS_RENAMEAT2: {paths: []pathArg{{dirfd: 0, path: 1, effect: effectRemove}, {dirfd: 2, path: 3, effect: effectCreate}}},
+	unix.SYS_BIND:      {net: netBind},
+	unix.SYS_CONNECT:   {net: netConnect},
+}
+
+// readRegs returns the syscall number and arguments at a syscall-entry stop.
+func readRegs(pid int) (nr uint64, args [6]uint64, err error) {
+	var regs unix.PtraceRegsArm64
+	if err := unix.PtraceGetRegSetArm64(pid, ntPrstatus, &regs); err != nil {
+		return 0, args, err
+	}
+	copy(args[:], regs.Regs[:6])
+	return regs.Regs[8], args, nil
+}
+
+// readReturn returns the syscall result at a syscall-exit stop.
+func readReturn(pid int) (int64, error) {
+	var regs unix.PtraceRegsArm64
+	if err := unix.PtraceGetRegSetArm64(pid, ntPrstatus, &regs); err != nil {
+		return 0, err
+	}
+	return int64(regs.Regs[0]), nil
+}
@@ -0,0 +1,15 @@
+//go:build !amd64 && !arm64
+
+package learn
+
+import "fmt"
+
+var syscalls = map[uint64]spec{}
+
+func readRegs(pid int) (nr uint64, args [6]uint64, err error) {
+	return 0, args, fmt.Errorf("learn mode is not supported on this architecture")
+}
+
+func readReturn(pid int) (int64, error) {
+	return 0, fmt.Errorf("learn mode is not supported on this architecture")
+}
@@ -1,64 +1,286 @@
 package log
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Level int
 
 const (
 	LevelError Level = iota
+	LevelWarn
 	LevelInfo
 	LevelDebug
+	LevelTrace
 )
 
-var (
-	debug = log.New(os.Stderr, "[landrun:debug] ", log.LstdFlags)
-	info  = log.New(os.Stderr, "[landrun] ", log.LstdFlags)
-	error = log.New(os.Stderr, "[landrun:error] ", log.LstdFlags)
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
 
+// textPrefixes are the prefixes of messages in text format.
+var textPrefixes = []string{"[landrun:error] ", "[landrun:warn] ", "[landrun] ", "[landrun:debug] ", "[landrun:trace] "}
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configure where and how messages are written.
+type Options struct {
+	// Level is the name of the most verbose level written: error, warn,
+	// info, debug or trace.
+	Level string
+	// Format is FormatText (the default) or FormatJSON.
+	Format string
+	// File is a file messages are appended to instead of stderr.
+	File string
+	// Syslog also sends messages to the local syslog daemon, or journald,
+	// through /dev/log.
+	Syslog bool
+}
+
+// Fields are the structured fields of a message. They are written as
+// separate fields in JSON output and omitted when empty; in text output only
+// the message is written.
+type Fields struct {
+	Path   string
+	Rights []string
+	// Port is only written if it is not 0.
+	Port int
+	Err  error
+}
+
+var (
+	mu           sync.Mutex
 	currentLevel = LevelInfo // default level
+	options      = Options{Format: FormatText}
+	out          = io.Writer(os.Stderr)
+	sysWriter    *syslog.Writer
+
+	// syslogNetwork and syslogAddr select the syslog daemon; empty values
+	// connect to the local one.
+	syslogNetwork, syslogAddr string
 )
 
-// SetLevel sets the logging level
+// ParseLevel returns the level named name.
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return LevelError, fmt.Errorf("invalid log level %q (expected %s)", name, strings.Join(levelNames, ", "))
+}
+
+// SetLevel sets the logging level. Unknown names select the error level.
 func SetLevel(level string) {
-	switch strings.ToLower(level) {
-	case "error":
-		currentLevel = LevelError
-	case "info":
-		currentLevel = LevelInfo
-	case "debug":
-		currentLevel = LevelDebug
+	l, _ := ParseLevel(level)
+	mu.Lock()
+	currentLevel = l
+	options.Level = l.String()
+	mu.Unlock()
+}
+
+// Configure sets the level, format and destinations of messages. An empty
+// Level keeps the current one.
+func Configure(o Options) error {
+	level := Level(-1)
+	if o.Level != "" {
+		l, err := ParseLevel(o.Level)
+		if err != nil {
+			return err
+		}
+		level = l
+	}
+	switch o.Format {
+	case "":
+		o.Format = FormatText
+	case FormatText, FormatJSON:
 	default:
-		currentLevel = LevelError
+		return fmt.Errorf("invalid log format %q (expected %s or %s)", o.Format, FormatText, FormatJSON)
+	}
+
+	var w io.Writer = os.Stderr
+	if o.File != "" {
+		path, err := filepath.Abs(o.File)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		o.File = path
+		w = f
+	}
+	var sw *syslog.Writer
+	if o.Syslog {
+		var err error
+		sw, err = syslog.Dial(syslogNetwork, syslogAddr, syslog.LOG_USER|syslog.LOG_INFO, "landrun")
+		if err != nil {
+			if f, ok := w.(*os.File); ok && f != os.Stderr {
+				f.Close()
+			}
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if f, ok := out.(*os.File); ok && f != os.Stderr {
+		f.Close()
+	}
+	if sysWriter != nil {
+		sysWriter.Close()
+	}
+	if level >= 0 {
+		currentLevel = level
+	}
+	o.Level = currentLevel.String()
+	options, out, sysWriter = o, w, sw
+	return nil
+}
+
+// Current returns the options in effect, with an absolute File path.
+func Current() Options {
+	mu.Lock()
+	defer mu.Unlock()
+	return options
+}
+
+// entry is a message in JSON format.
+type entry struct {
+	Time    string   `json:"time"`
+	Level   string   `json:"level"`
+	Event   string   `json:"event"`
+	Message string   `json:"msg"`
+	Path    string   `json:"path,omitempty"`
+	Rights  []string `json:"rights,omitempty"`
+	Port    int      `json:"port,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func write(level Level, event string, f Fields, msg string, fatal bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level > currentLevel && !fatal {
+		return
+	}
+
+	now := time.Now()
+	var line string
+	if options.Format == FormatJSON {
+		e := entry{
+			Time:    now.Format(time.RFC3339Nano),
+			Level:   level.String(),
+			Event:   event,
+			Message: msg,
+			Path:    f.Path,
+			Rights:  f.Rights,
+			Port:    f.Port,
+		}
+		if f.Err != nil {
+			e.Error = f.Err.Error()
+		}
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.Encode(e)
+		line = b.String()
+	} else {
+		line = textPrefixes[level] + now.Format("2006/01/02 15:04:05 ") + msg + "\n"
+	}
+	io.WriteString(out, line)
+	// Fatal errors explain why landrun exits, so they are shown on the
+	// terminal as well.
+	if fatal && out != os.Stderr {
+		io.WriteString(os.Stderr, textPrefixes[level]+now.Format("2006/01/02 15:04:05 ")+msg+"\n")
+	}
+
+	if sysWriter != nil {
+		text := strings.TrimSuffix(line, "\n")
+		if options.Format == FormatText {
+			text = msg
+		}
+		switch level {
+		case LevelError:
+			sysWriter.Err(text)
+		case LevelWarn:
+			sysWriter.Warning(text)
+		case LevelInfo:
+			sysWriter.Info(text)
+		default:
+			sysWriter.Debug(text)
+		}
 	}
 }
 
+// message formats a printf-style message. If the last argument is an error,
+// it is also returned as the error field.
+func message(format string, v []interface{}) (string, Fields) {
+	var f Fields
+	if len(v) > 0 {
+		if err, ok := v[len(v)-1].(error); ok {
+			f.Err = err
+		}
+	}
+	return fmt.Sprintf(format, v...), f
+}
+
+// Event logs a structured message. event is a short machine-readable name
+// such as "path_rule" identifying the kind of message.
+func Event(level Level, event string, f Fields, format string, v ...interface{}) {
+	write(level, event, f, fmt.Sprintf(format, v...), false)
+}
+
+// Trace logs a trace message
+func Trace(format string, v ...interface{}) {
+	msg, f := message(format, v)
+	write(LevelTrace, "message", f, msg, false)
+}
+
 // Debug logs a debug message
 func Debug(format string, v ...interface{}) {
-	if currentLevel >= LevelDebug {
-		debug.Printf(format, v...)
-	}
+	msg, f := message(format, v)
+	write(LevelDebug, "message", f, msg, false)
 }
 
 // Info logs an info message
 func Info(format string, v ...interface{}) {
-	if currentLevel >= LevelInfo {
-		info.Printf(format, v...)
-	}
+	msg, f := message(format, v)
+	write(LevelInfo, "message", f, msg, false)
+}
+
+// Warn logs a warning
+func Warn(format string, v ...interface{}) {
+	msg, f := message(format, v)
+	write(LevelWarn, "warning", f, msg, false)
 }
 
 // Error logs an error message
 func Error(format string, v ...interface{}) {
-	if currentLevel >= LevelError {
-		error.Printf(format, v...)
-	}
+	msg, f := message(format, v)
+	write(LevelError, "error", f, msg, false)
 }
 
 // Fatal logs an error message and exits
 func Fatal(format string, v ...interface{}) {
-	error.Printf(format, v...)
+	msg, f := message(format, v)
+	write(LevelError, "fatal", f, msg, true)
 	os.Exit(1)
 }
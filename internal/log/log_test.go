@@ -0,0 +1,125 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configure sets up logging for a test and restores the defaults after it.
+func configure(t *testing.T, o Options) {
+	t.Helper()
+	if err := Configure(o); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	t.Cleanup(func() { Configure(Options{Level: "info"}) })
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "landrun.log")
+	configure(t, Options{Level: "trace", Format: FormatJSON, File: path})
+
+	Event(LevelTrace, "path_rule", Fields{Path: "/usr", Rights: []string{"execute", "read_file"}}, "Rule for %s", "/usr")
+	Event(LevelDebug, "add_port", Fields{Port: 443, Rights: []string{"connect_tcp"}}, "Adding TCP connect port: %d", 443)
+	Warn("Failed to read %s: %v", "/etc", errors.New("denied"))
+
+	lines := readLines(t, path)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", lines)
+	}
+	var entries []entry
+	for _, line := range lines {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		if e.Time == "" {
+			t.Errorf("missing time in %q", line)
+		}
+		e.Time = ""
+		entries = append(entries, e)
+	}
+	want := []entry{
+		{Level: "trace", Event: "path_rule", Message: "Rule for /usr", Path: "/usr", Rights: []string{"execute", "read_file"}},
+		{Level: "debug", Event: "add_port", Message: "Adding TCP connect port: 443", Rights: []string{"connect_tcp"}, Port: 443},
+		{Level: "warn", Event: "warning", Message: "Failed to read /etc: denied", Error: "denied"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "landrun.log")
+	configure(t, Options{Level: "warn", File: path})
+
+	Trace("trace")
+	Debug("debug")
+	Info("info")
+	Warn("warn")
+	Error("error")
+
+	lines := readLines(t, path)
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "[landrun:warn] ") || !strings.HasSuffix(lines[1], " error") {
+		t.Errorf("unexpected output %q", lines)
+	}
+	if got := Current(); got.Level != "warn" || got.Format != FormatText || got.File != path {
+		t.Errorf("Current() = %+v", got)
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skipf("cannot listen on a unix socket: %v", err)
+	}
+	defer conn.Close()
+	syslogNetwork, syslogAddr = "unixgram", addr
+	defer func() { syslogNetwork, syslogAddr = "", "" }()
+
+	configure(t, Options{Level: "info", File: filepath.Join(t.TempDir(), "landrun.log"), Syslog: true})
+	Warn("sandbox %s", "applied")
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// <12> is the user facility with the warning severity.
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<12>") || !strings.Contains(msg, "landrun") || !strings.HasSuffix(strings.TrimSpace(msg), "sandbox applied") {
+		t.Errorf("unexpected syslog message %q", msg)
+	}
+}
+
+func TestConfigureErrors(t *testing.T) {
+	cases := []struct {
+		o    Options
+		want string
+	}{
+		{Options{Level: "verbose"}, `invalid log level "verbose"`},
+		{Options{Format: "xml"}, `invalid log format "xml"`},
+		{Options{File: filepath.Join(t.TempDir(), "missing", "landrun.log")}, "failed to open log file"},
+	}
+	for _, tc := range cases {
+		err := Configure(tc.o)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Configure(%+v) = %v, want an error containing %q", tc.o, err, tc.want)
+		}
+	}
+}
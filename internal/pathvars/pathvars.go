@@ -0,0 +1,124 @@
+// Package pathvars expands variables and a leading tilde in paths.
+package pathvars
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// Expander expands $NAME and ${NAME} references and a leading ~ or ~user in
+// paths.
+//
+// Variables are looked up in order in Vars, in the process environment and
+// finally in the defaults for HOME and the XDG base directories. With Strict
+// set, references to undefined variables are an error; otherwise they expand
+// to the empty string and Undefined is called for each of them.
+type Expander struct {
+	Vars      map[string]string
+	Strict    bool
+	Undefined func(name, path string)
+
+	// LookupEnv replaces os.LookupEnv, for tests.
+	LookupEnv func(key string) (string, bool)
+}
+
+// Builtins returns the variables landrun defines itself: CWD, the working
+// directory, and EXE_DIR, the directory of the resolved binary if known.
+func Builtins(binary string) map[string]string {
+	vars := map[string]string{}
+	if cwd, err := os.Getwd(); err == nil {
+		vars["CWD"] = cwd
+	}
+	if binary != "" {
+		if abs, err := filepath.Abs(binary); err == nil {
+			vars["EXE_DIR"] = filepath.Dir(abs)
+		}
+	}
+	return vars
+}
+
+// Expand returns path with variables and a leading tilde expanded. "$$"
+// stands for a literal dollar sign.
+func (e *Expander) Expand(path string) (string, error) {
+	var undefined []string
+	expanded := os.Expand(path, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		if v, ok := e.lookup(name); ok {
+			return v
+		}
+		undefined = append(undefined, name)
+		return ""
+	})
+	if len(undefined) > 0 {
+		if e.Strict {
+			return "", fmt.Errorf("path %q: undefined variable %s", path, strings.Join(undefined, ", "))
+		}
+		if e.Undefined != nil {
+			for _, name := range undefined {
+				e.Undefined(name, path)
+			}
+		}
+	}
+	return e.expandTilde(expanded)
+}
+
+func (e *Expander) lookup(name string) (string, bool) {
+	if v, ok := e.Vars[name]; ok {
+		return v, true
+	}
+	lookupEnv := e.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	if v, ok := lookupEnv(name); ok && v != "" {
+		return v, true
+	}
+
+	// Fall back to the defaults of the XDG base directory specification.
+	dirs := map[string]string{
+		"XDG_CONFIG_HOME": ".config",
+		"XDG_DATA_HOME":   ".local/share",
+		"XDG_STATE_HOME":  ".local/state",
+		"XDG_CACHE_HOME":  ".cache",
+	}
+	switch {
+	case name == "HOME":
+		if u, err := user.Current(); err == nil && u.HomeDir != "" {
+			return u.HomeDir, true
+		}
+	case dirs[name] != "":
+		if home, ok := e.lookup("HOME"); ok {
+			return filepath.Join(home, dirs[name]), true
+		}
+	}
+	return "", false
+}
+
+// expandTilde replaces a leading ~ with the home directory of the current
+// user and ~name with that of the named user.
+func (e *Expander) expandTilde(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	name, rest := path[1:], ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+	if name == "" {
+		home, ok := e.lookup("HOME")
+		if !ok {
+			return "", fmt.Errorf("path %q: cannot determine home directory", path)
+		}
+		return home + rest, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("path %q: %w", path, err)
+	}
+	return u.HomeDir + rest, nil
+}
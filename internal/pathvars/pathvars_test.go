@@ -0,0 +1,52 @@
+package pathvars
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{"HOME": "/home/alice", "XDG_RUNTIME_DIR": "/run/user/1000"}
+	e := &Expander{
+		Vars: map[string]string{"CWD": "/work", "EXE_DIR": "/opt/app/bin", "DATA": "/srv/data"},
+		LookupEnv: func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		},
+	}
+
+	cases := map[string]string{
+		"~":                            "/home/alice",
+		"~/.cache":                     "/home/alice/.cache",
+		"$HOME/docs":                   "/home/alice/docs",
+		"${XDG_RUNTIME_DIR}/bus":       "/run/user/1000/bus",
+		"$XDG_CONFIG_HOME/app":         "/home/alice/.config/app",
+		"${CWD}/out":                   "/work/out",
+		"${EXE_DIR}/../lib":            "/opt/app/bin/../lib",
+		"${DATA}/cache/*.db":           "/srv/data/cache/*.db",
+		"/price/$$5":                   "/price/$5",
+		"/no/variables/here~":          "/no/variables/here~",
+		"/usr/lib/x86_64-linux-gnu/**": "/usr/lib/x86_64-linux-gnu/**",
+	}
+	for in, want := range cases {
+		got, err := e.Expand(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", in, got, want)
+		}
+	}
+
+	var undefined []string
+	e.Undefined = func(name, path string) { undefined = append(undefined, name) }
+	if got, err := e.Expand("$NOPE/x"); err != nil || got != "/x" || len(undefined) != 1 {
+		t.Errorf("lenient expansion: got %q, %v, undefined %v", got, err, undefined)
+	}
+
+	e.Strict = true
+	if _, err := e.Expand("${NOPE}/x"); err == nil || !strings.Contains(err.Error(), "undefined variable NOPE") {
+		t.Errorf("expected an undefined variable error, got %v", err)
+	}
+}
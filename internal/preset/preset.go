@@ -0,0 +1,94 @@
+// Package preset provides the named sandbox baselines built into landrun.
+// Presets are regular profile files embedded in the binary.
+package preset
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zouuup/landrun/internal/log"
+	"github.com/zouuup/landrun/internal/profile"
+)
+
+//go:embed presets/*.toml
+var files embed.FS
+
+// Names returns the names of all built-in presets in sorted order.
+func Names() []string {
+	entries, err := files.ReadDir("presets")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".toml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the preset with the given name as it is declared, without
+// resolving the presets it includes.
+func Get(name string) (*profile.Profile, error) {
+	file := path.Join("presets", name+".toml")
+	data, err := files.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return profile.Parse(file, data)
+}
+
+// Resolve expands the presets referenced by p, including presets referenced
+// by other presets, and returns a profile in which p's own options are merged
+// on top of them. Each preset is applied once. Preset paths are marked
+// optional, since presets cover the layouts of several distributions.
+func Resolve(p *profile.Profile) (*profile.Profile, error) {
+	out := &profile.Profile{}
+	done := map[string]bool{}
+	var applied []string
+	if err := expand(out, p.Presets, done, nil, &applied); err != nil {
+		return nil, err
+	}
+
+	own := *p
+	own.Presets = nil
+	out.Merge(&own)
+	out.Description = p.Description
+	out.Presets = applied
+	return out, nil
+}
+
+// expand merges the named presets into out, depth first, so that included
+// presets come before the presets including them. The stack holds the chain
+// of presets currently being expanded and is used to detect cycles.
+func expand(out *profile.Profile, names []string, done map[string]bool, stack []string, applied *[]string) error {
+	for _, name := range names {
+		for _, s := range stack {
+			if s == name {
+				return fmt.Errorf("preset cycle: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+		}
+		if done[name] {
+			continue
+		}
+
+		p, err := Get(name)
+		if err != nil {
+			return err
+		}
+		if err := expand(out, p.Presets, done, append(stack, name), applied); err != nil {
+			return err
+		}
+		p.Presets = nil
+		p.Attribute(func(key string) string { return fmt.Sprintf("preset %s (%s)", name, key) })
+		out.Merge(p)
+
+		done[name] = true
+		*applied = append(*applied, name)
+		log.Debug("Applied preset %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package preset
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zouuup/landrun/internal/profile"
+)
+
+func TestAllPresetsParse(t *testing.T) {
+	names := Names()
+	if len(names) == 0 {
+		t.Fatalf("expected built-in presets")
+	}
+	for _, name := range names {
+		p, err := Get(name)
+		if err != nil {
+			t.Fatalf("preset %s: %v", name, err)
+		}
+		if p.Description == "" {
+			t.Errorf("preset %s has no description", name)
+		}
+		if _, err := Resolve(&profile.Profile{Presets: []string{name}}); err != nil {
+			t.Errorf("preset %s does not resolve: %v", name, err)
+		}
+	}
+}
+
+func TestResolveAppliesIncludedPresetsOnce(t *testing.T) {
+	p := &profile.Profile{
+		Description: "mine",
+		Presets:     []string{"system-ro", "minimal-exec"},
+		ReadOnlyPaths: []string{
+			"/nonexistent/kept/because/not/from/a/preset",
+		},
+	}
+	out, err := Resolve(p)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !reflect.DeepEqual(out.Presets, []string{"minimal-exec", "system-ro"}) {
+		t.Errorf("applied presets = %v", out.Presets)
+	}
+	if out.Description != "mine" {
+		t.Errorf("description = %q", out.Description)
+	}
+	last := out.ReadOnlyPaths[len(out.ReadOnlyPaths)-1]
+	if last != "/nonexistent/kept/because/not/from/a/preset" {
+		t.Errorf("own paths should be merged last and kept, got %v", out.ReadOnlyPaths)
+	}
+}
+
+func TestPresetPathsAreOptional(t *testing.T) {
+	for _, name := range Names() {
+		p, err := Get(name)
+		if err != nil {
+			t.Fatalf("preset %s: %v", name, err)
+		}
+		paths := append(append(append(append([]string{}, p.ReadOnlyPaths...), p.ReadOnlyExecutablePaths...), p.ReadWritePaths...), p.ReadWriteExecutablePaths...)
+		for _, path := range paths {
+			if !strings.HasPrefix(path, "?") {
+				t.Errorf("preset %s: path %s should be optional", name, path)
+			}
+		}
+	}
+}
+
+func TestResolveUnknownPreset(t *testing.T) {
+	_, err := Resolve(&profile.Profile{Presets: []string{"no-such-preset"}})
+	if err == nil || !strings.Contains(err.Error(), `unknown preset "no-such-preset"`) {
+		t.Fatalf("expected unknown preset error, got %v", err)
+	}
+}
@@ -0,0 +1,869 @@
+// Package profile implements declarative sandbox profiles. A profile file
+// describes the same options as the landrun command line and can be written
+// in TOML, YAML or JSON.
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zouuup/landrun/internal/env"
+	"github.com/zouuup/landrun/internal/rlimit"
+	"github.com/zouuup/landrun/internal/sandbox"
+	"github.com/zouuup/landrun/internal/seccomp"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds sandbox options loaded from a profile file or collected from
+// command line flags. Boolean options are pointers so that an unset value can
+// be told apart from an explicit false when profiles are merged.
+type Profile struct {
+	Description              string
+	Presets                  []string
+	ReadOnlyPaths            []string
+	ReadOnlyExecutablePaths  []string
+	ReadWritePaths           []string
+	ReadWriteExecutablePaths []string
+	CustomPaths              []sandbox.CustomPath
+	DenyPaths                []string
+	CreatePaths              []sandbox.CreatePath
+	MissingPaths             string
+	BindTCPPorts             []int
+	ConnectTCPPorts          []int
+	AllowSocketFamilies      []string
+	DenySocketFamilies       []string
+	NoUDP                    *bool
+	BestEffort               *bool
+	UnrestrictedFilesystem   *bool
+	UnrestrictedNetwork      *bool
+	ScopeAbstractUnix        *bool
+	ScopeSignal              *bool
+	Env                      []string
+	EnvFiles                 []string
+	EnvPatterns              []string
+	UnsetEnv                 []string
+	InheritEnv               *bool
+	EnvStrict                *bool
+	EnvPreset                string
+	Ldd                      *bool
+	LddHeuristics            *bool
+	AddExec                  *bool
+	FailEmptyGlob            *bool
+	StrictVars               *bool
+	Seccomp                  string
+	SeccompDeny              []string
+	SeccompAllow             []string
+	SeccompAction            string
+	SeccompProfile           string
+
+	// Vars are parameters that can be referenced in paths as $NAME or
+	// ${NAME}.
+	Vars map[string]string
+
+	// Limits are the resource limits of the command, by limit name.
+	Limits map[string]rlimit.Limit
+
+	// Sources records where each path and port came from, using the same
+	// keys as sandbox.Config.Sources.
+	Sources map[string][]string
+}
+
+// KeyError reports an invalid value for a key in a profile file.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("key %q: %v", e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// keySetter decodes the raw value of a single profile key into p.
+type keySetter func(p *Profile, key string, v interface{}) error
+
+// keys maps every supported profile key to its decoder. Key names match the
+// corresponding command line flags.
+var keys = map[string]keySetter{
+	"description": func(p *Profile, key string, v interface{}) (err error) {
+		p.Description, err = asString(key, v)
+		return err
+	},
+	"ro":          stringList(func(p *Profile) *[]string { return &p.ReadOnlyPaths }),
+	"rox":         stringList(func(p *Profile) *[]string { return &p.ReadOnlyExecutablePaths }),
+	"rw":          stringList(func(p *Profile) *[]string { return &p.ReadWritePaths }),
+	"rwx":         stringList(func(p *Profile) *[]string { return &p.ReadWriteExecutablePaths }),
+	"env":         stringList(func(p *Profile) *[]string { return &p.Env }),
+	"env-file":    stringList(func(p *Profile) *[]string { return &p.EnvFiles }),
+	"env-pattern": stringList(func(p *Profile) *[]string { return &p.EnvPatterns }),
+	"unset-env":   stringList(func(p *Profile) *[]string { return &p.UnsetEnv }),
+	"inherit-env": boolean(func(p *Profile) **bool { return &p.InheritEnv }),
+	"env-strict":  boolean(func(p *Profile) **bool { return &p.EnvStrict }),
+	"env-preset":  validString(func(p *Profile) *string { return &p.EnvPreset }, env.ValidatePreset),
+
+	"path": customPaths,
+	"deny": stringList(func(p *Profile) *[]string { return &p.DenyPaths }),
+
+	"rw-create":     createPaths(false),
+	"rwx-create":    createPaths(true),
+	"missing-paths": validString(func(p *Profile) *string { return &p.MissingPaths }, sandbox.ValidateMissingPolicy),
+
+	"preset": stringList(func(p *Profile) *[]string { return &p.Presets }),
+
+	"bind-tcp":    portList(func(p *Profile) *[]int { return &p.BindTCPPorts }),
+	"connect-tcp": portList(func(p *Profile) *[]int { return &p.ConnectTCPPorts }),
+
+	"allow-socket-family": socketFamilies(func(p *Profile) *[]string { return &p.AllowSocketFamilies }),
+	"deny-socket-family":  socketFamilies(func(p *Profile) *[]string { return &p.DenySocketFamilies }),
+	"no-udp":              boolean(func(p *Profile) **bool { return &p.NoUDP }),
+
+	"best-effort":             boolean(func(p *Profile) **bool { return &p.BestEffort }),
+	"unrestricted-filesystem": boolean(func(p *Profile) **bool { return &p.UnrestrictedFilesystem }),
+	"unrestricted-network":    boolean(func(p *Profile) **bool { return &p.UnrestrictedNetwork }),
+	"scope-abstract-unix":     boolean(func(p *Profile) **bool { return &p.ScopeAbstractUnix }),
+	"scope-signal":            boolean(func(p *Profile) **bool { return &p.ScopeSignal }),
+	"ldd":                     boolean(func(p *Profile) **bool { return &p.Ldd }),
+	"ldd-heuristics":          boolean(func(p *Profile) **bool { return &p.LddHeuristics }),
+	"add-exec":                boolean(func(p *Profile) **bool { return &p.AddExec }),
+	"fail-empty-glob":         boolean(func(p *Profile) **bool { return &p.FailEmptyGlob }),
+	"strict-vars":             boolean(func(p *Profile) **bool { return &p.StrictVars }),
+
+	"vars": variables,
+
+	"seccomp":         validString(func(p *Profile) *string { return &p.Seccomp }, seccomp.ValidateMode),
+	"seccomp-deny":    stringList(func(p *Profile) *[]string { return &p.SeccompDeny }),
+	"seccomp-allow":   stringList(func(p *Profile) *[]string { return &p.SeccompAllow }),
+	"seccomp-action":  validString(func(p *Profile) *string { return &p.SeccompAction }, seccomp.ValidateAction),
+	"seccomp-profile": str(func(p *Profile) *string { return &p.SeccompProfile }),
+}
+
+func init() {
+	for _, name := range rlimit.Names() {
+		keys["limit-"+name] = limit(name)
+	}
+}
+
+// Load reads and parses the profile file at path. The format is chosen from
+// the file extension (.toml, .yaml, .yml or .json).
+func Load(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse parses profile data. The name is used to pick the format from its
+// extension and to prefix error messages.
+func Parse(name string, data []byte) (*Profile, error) {
+	raw, err := decode(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	p, err := fromMap(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
+
+// decode parses data into a generic map according to the file extension.
+func decode(name string, data []byte) (map[string]interface{}, error) {
+	raw := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".toml":
+		if _, err := toml.Decode(string(data), &raw); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				line := 1 + bytes.Count(data[:syntaxErr.Offset], []byte("\n"))
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported profile format %q (expected .toml, .yaml, .yml or .json)", ext)
+	}
+	return raw, nil
+}
+
+// document is the serialized form of a profile, used by Encode. Field order
+// determines the order of keys in the output.
+type document struct {
+	Description            string   `toml:"description,omitempty" yaml:"description,omitempty" json:"description,omitempty"`
+	Preset                 []string `toml:"preset,omitempty" yaml:"preset,omitempty" json:"preset,omitempty"`
+	ReadOnly               []string `toml:"ro,omitempty" yaml:"ro,omitempty" json:"ro,omitempty"`
+	ReadOnlyExec           []string `toml:"rox,omitempty" yaml:"rox,omitempty" json:"rox,omitempty"`
+	ReadWrite              []string `toml:"rw,omitempty" yaml:"rw,omitempty" json:"rw,omitempty"`
+	ReadWriteExec          []string `toml:"rwx,omitempty" yaml:"rwx,omitempty" json:"rwx,omitempty"`
+	Path                   []string `toml:"path,omitempty" yaml:"path,omitempty" json:"path,omitempty"`
+	Deny                   []string `toml:"deny,omitempty" yaml:"deny,omitempty" json:"deny,omitempty"`
+	ReadWriteCreate        []string `toml:"rw-create,omitempty" yaml:"rw-create,omitempty" json:"rw-create,omitempty"`
+	ReadWriteExecCreate    []string `toml:"rwx-create,omitempty" yaml:"rwx-create,omitempty" json:"rwx-create,omitempty"`
+	MissingPaths           string   `toml:"missing-paths,omitempty" yaml:"missing-paths,omitempty" json:"missing-paths,omitempty"`
+	BindTCP                []int    `toml:"bind-tcp,omitempty" yaml:"bind-tcp,omitempty" json:"bind-tcp,omitempty"`
+	ConnectTCP             []int    `toml:"connect-tcp,omitempty" yaml:"connect-tcp,omitempty" json:"connect-tcp,omitempty"`
+	AllowSocketFamily      []string `toml:"allow-socket-family,omitempty" yaml:"allow-socket-family,omitempty" json:"allow-socket-family,omitempty"`
+	DenySocketFamily       []string `toml:"deny-socket-family,omitempty" yaml:"deny-socket-family,omitempty" json:"deny-socket-family,omitempty"`
+	NoUDP                  *bool    `toml:"no-udp,omitempty" yaml:"no-udp,omitempty" json:"no-udp,omitempty"`
+	Env                    []string `toml:"env,omitempty" yaml:"env,omitempty" json:"env,omitempty"`
+	EnvFile                []string `toml:"env-file,omitempty" yaml:"env-file,omitempty" json:"env-file,omitempty"`
+	EnvPattern             []string `toml:"env-pattern,omitempty" yaml:"env-pattern,omitempty" json:"env-pattern,omitempty"`
+	UnsetEnv               []string `toml:"unset-env,omitempty" yaml:"unset-env,omitempty" json:"unset-env,omitempty"`
+	InheritEnv             *bool    `toml:"inherit-env,omitempty" yaml:"inherit-env,omitempty" json:"inherit-env,omitempty"`
+	EnvStrict              *bool    `toml:"env-strict,omitempty" yaml:"env-strict,omitempty" json:"env-strict,omitempty"`
+	EnvPreset              string   `toml:"env-preset,omitempty" yaml:"env-preset,omitempty" json:"env-preset,omitempty"`
+	BestEffort             *bool    `toml:"best-effort,omitempty" yaml:"best-effort,omitempty" json:"best-effort,omitempty"`
+	UnrestrictedFilesystem *bool    `toml:"unrestricted-filesystem,omitempty" yaml:"unrestricted-filesystem,omitempty" json:"unrestricted-filesystem,omitempty"`
+	UnrestrictedNetwork    *bool    `toml:"unrestricted-network,omitempty" yaml:"unrestricted-network,omitempty" json:"unrestricted-network,omitempty"`
+	ScopeAbstractUnix      *bool    `toml:"scope-abstract-unix,omitempty" yaml:"scope-abstract-unix,omitempty" json:"scope-abstract-unix,omitempty"`
+	ScopeSignal            *bool    `toml:"scope-signal,omitempty" yaml:"scope-signal,omitempty" json:"scope-signal,omitempty"`
+	Ldd                    *bool    `toml:"ldd,omitempty" yaml:"ldd,omitempty" json:"ldd,omitempty"`
+	LddHeuristics          *bool    `toml:"ldd-heuristics,omitempty" yaml:"ldd-heuristics,omitempty" json:"ldd-heuristics,omitempty"`
+	AddExec                *bool    `toml:"add-exec,omitempty" yaml:"add-exec,omitempty" json:"add-exec,omitempty"`
+	FailEmptyGlob          *bool    `toml:"fail-empty-glob,omitempty" yaml:"fail-empty-glob,omitempty" json:"fail-empty-glob,omitempty"`
+	StrictVars             *bool    `toml:"strict-vars,omitempty" yaml:"strict-vars,omitempty" json:"strict-vars,omitempty"`
+
+	Seccomp        string   `toml:"seccomp,omitempty" yaml:"seccomp,omitempty" json:"seccomp,omitempty"`
+	SeccompDeny    []string `toml:"seccomp-deny,omitempty" yaml:"seccomp-deny,omitempty" json:"seccomp-deny,omitempty"`
+	SeccompAllow   []string `toml:"seccomp-allow,omitempty" yaml:"seccomp-allow,omitempty" json:"seccomp-allow,omitempty"`
+	SeccompAction  string   `toml:"seccomp-action,omitempty" yaml:"seccomp-action,omitempty" json:"seccomp-action,omitempty"`
+	SeccompProfile string   `toml:"seccomp-profile,omitempty" yaml:"seccomp-profile,omitempty" json:"seccomp-profile,omitempty"`
+	LimitAS        string   `toml:"limit-as,omitempty" yaml:"limit-as,omitempty" json:"limit-as,omitempty"`
+	LimitCPU       string   `toml:"limit-cpu,omitempty" yaml:"limit-cpu,omitempty" json:"limit-cpu,omitempty"`
+	LimitNofile    string   `toml:"limit-nofile,omitempty" yaml:"limit-nofile,omitempty" json:"limit-nofile,omitempty"`
+	LimitNproc     string   `toml:"limit-nproc,omitempty" yaml:"limit-nproc,omitempty" json:"limit-nproc,omitempty"`
+	LimitFsize     string   `toml:"limit-fsize,omitempty" yaml:"limit-fsize,omitempty" json:"limit-fsize,omitempty"`
+	LimitCore      string   `toml:"limit-core,omitempty" yaml:"limit-core,omitempty" json:"limit-core,omitempty"`
+	LimitStack     string   `toml:"limit-stack,omitempty" yaml:"limit-stack,omitempty" json:"limit-stack,omitempty"`
+
+	Vars map[string]string `toml:"vars,omitempty" yaml:"vars,omitempty" json:"vars,omitempty"`
+}
+
+// Encode serializes the profile in the format matching the extension of
+// name, so that the result can be loaded again with Load.
+func (p *Profile) Encode(name string) ([]byte, error) {
+	doc := document{
+		Description:            p.Description,
+		Preset:                 p.Presets,
+		ReadOnly:               p.ReadOnlyPaths,
+		ReadOnlyExec:           p.ReadOnlyExecutablePaths,
+		ReadWrite:              p.ReadWritePaths,
+		ReadWriteExec:          p.ReadWriteExecutablePaths,
+		Path:                   p.customPathSpecs(),
+		Deny:                   p.DenyPaths,
+		ReadWriteCreate:        p.createPathSpecs(false),
+		ReadWriteExecCreate:    p.createPathSpecs(true),
+		MissingPaths:           p.MissingPaths,
+		BindTCP:                p.BindTCPPorts,
+		ConnectTCP:             p.ConnectTCPPorts,
+		AllowSocketFamily:      p.AllowSocketFamilies,
+		DenySocketFamily:       p.DenySocketFamilies,
+		NoUDP:                  p.NoUDP,
+		Env:                    p.Env,
+		EnvFile:                p.EnvFiles,
+		EnvPattern:             p.EnvPatterns,
+		UnsetEnv:               p.UnsetEnv,
+		InheritEnv:             p.InheritEnv,
+		EnvStrict:              p.EnvStrict,
+		EnvPreset:              p.EnvPreset,
+		BestEffort:             p.BestEffort,
+		UnrestrictedFilesystem: p.UnrestrictedFilesystem,
+		UnrestrictedNetwork:    p.UnrestrictedNetwork,
+		ScopeAbstractUnix:      p.ScopeAbstractUnix,
+		ScopeSignal:            p.ScopeSignal,
+		Ldd:                    p.Ldd,
+		LddHeuristics:          p.LddHeuristics,
+		AddExec:                p.AddExec,
+		FailEmptyGlob:          p.FailEmptyGlob,
+		StrictVars:             p.StrictVars,
+		Seccomp:                p.Seccomp,
+		SeccompDeny:            p.SeccompDeny,
+		SeccompAllow:           p.SeccompAllow,
+		SeccompAction:          p.SeccompAction,
+		SeccompProfile:         p.SeccompProfile,
+		LimitAS:                p.limitSpec("as"),
+		LimitCPU:               p.limitSpec("cpu"),
+		LimitNofile:            p.limitSpec("nofile"),
+		LimitNproc:             p.limitSpec("nproc"),
+		LimitFsize:             p.limitSpec("fsize"),
+		LimitCore:              p.limitSpec("core"),
+		LimitStack:             p.limitSpec("stack"),
+		Vars:                   p.Vars,
+	}
+
+	var buf bytes.Buffer
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".toml":
+		if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	case ".json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported profile format %q (expected .toml, .yaml, .yml or .json)", ext)
+	}
+	return buf.Bytes(), nil
+}
+
+// fromMap converts a decoded profile document into a Profile, rejecting
+// unknown keys and values of the wrong type.
+func fromMap(raw map[string]interface{}) (*Profile, error) {
+	names := make([]string, 0, len(raw))
+	for k := range raw {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	p := &Profile{}
+	for _, k := range names {
+		set, ok := keys[k]
+		if !ok {
+			return nil, &KeyError{Key: k, Err: errors.New("unknown key")}
+		}
+		if err := set(p, k, raw[k]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Merge adds the options of o on top of p. Lists are appended, and boolean
+// options, variables, limits and other single values set in o override
+// those in p.
+func (p *Profile) Merge(o *Profile) {
+	if o == nil {
+		return
+	}
+	if p.Description == "" {
+		p.Description = o.Description
+	}
+	p.Presets = append(p.Presets, o.Presets...)
+	p.ReadOnlyPaths = append(p.ReadOnlyPaths, o.ReadOnlyPaths...)
+	p.ReadOnlyExecutablePaths = append(p.ReadOnlyExecutablePaths, o.ReadOnlyExecutablePaths...)
+	p.ReadWritePaths = append(p.ReadWritePaths, o.ReadWritePaths...)
+	p.ReadWriteExecutablePaths = append(p.ReadWriteExecutablePaths, o.ReadWriteExecutablePaths...)
+	p.CustomPaths = append(p.CustomPaths, o.CustomPaths...)
+	p.DenyPaths = append(p.DenyPaths, o.DenyPaths...)
+	p.CreatePaths = append(p.CreatePaths, o.CreatePaths...)
+	if o.MissingPaths != "" {
+		p.MissingPaths = o.MissingPaths
+	}
+	p.BindTCPPorts = append(p.BindTCPPorts, o.BindTCPPorts...)
+	p.ConnectTCPPorts = append(p.ConnectTCPPorts, o.ConnectTCPPorts...)
+	p.AllowSocketFamilies = append(p.AllowSocketFamilies, o.AllowSocketFamilies...)
+	p.DenySocketFamilies = append(p.DenySocketFamilies, o.DenySocketFamilies...)
+	mergeBool(&p.NoUDP, o.NoUDP)
+	p.Env = append(p.Env, o.Env...)
+	p.EnvFiles = append(p.EnvFiles, o.EnvFiles...)
+	p.EnvPatterns = append(p.EnvPatterns, o.EnvPatterns...)
+	p.UnsetEnv = append(p.UnsetEnv, o.UnsetEnv...)
+	mergeBool(&p.InheritEnv, o.InheritEnv)
+	mergeBool(&p.EnvStrict, o.EnvStrict)
+	if o.EnvPreset != "" {
+		p.EnvPreset = o.EnvPreset
+	}
+	mergeBool(&p.BestEffort, o.BestEffort)
+	mergeBool(&p.UnrestrictedFilesystem, o.UnrestrictedFilesystem)
+	mergeBool(&p.UnrestrictedNetwork, o.UnrestrictedNetwork)
+	mergeBool(&p.ScopeAbstractUnix, o.ScopeAbstractUnix)
+	mergeBool(&p.ScopeSignal, o.ScopeSignal)
+	mergeBool(&p.Ldd, o.Ldd)
+	mergeBool(&p.LddHeuristics, o.LddHeuristics)
+	mergeBool(&p.AddExec, o.AddExec)
+	mergeBool(&p.FailEmptyGlob, o.FailEmptyGlob)
+	mergeBool(&p.StrictVars, o.StrictVars)
+	for name, value := range o.Vars {
+		if p.Vars == nil {
+			p.Vars = map[string]string{}
+		}
+		p.Vars[name] = value
+	}
+	if o.Seccomp != "" {
+		p.Seccomp = o.Seccomp
+	}
+	p.SeccompDeny = append(p.SeccompDeny, o.SeccompDeny...)
+	p.SeccompAllow = append(p.SeccompAllow, o.SeccompAllow...)
+	if o.SeccompAction != "" {
+		p.SeccompAction = o.SeccompAction
+	}
+	if o.SeccompProfile != "" {
+		p.SeccompProfile = o.SeccompProfile
+	}
+	for name, l := range o.Limits {
+		if p.Limits == nil {
+			p.Limits = map[string]rlimit.Limit{}
+		}
+		p.Limits[name] = l
+	}
+	for key, sources := range o.Sources {
+		for _, source := range sources {
+			p.addSource(key, source)
+		}
+	}
+}
+
+// Attribute records the origin of every path and port in the profile,
+// replacing any previous attribution. The label function is called with the
+// profile key (such as "rox") and returns the description of the source.
+func (p *Profile) Attribute(label func(key string) string) {
+	p.Sources = nil
+	paths := []struct {
+		key    string
+		values []string
+	}{
+		{"ro", p.ReadOnlyPaths},
+		{"rox", p.ReadOnlyExecutablePaths},
+		{"rw", p.ReadWritePaths},
+		{"rwx", p.ReadWriteExecutablePaths},
+	}
+	for _, l := range paths {
+		for _, path := range l.values {
+			p.addSource(path, label(l.key))
+		}
+	}
+	for _, cp := range p.CustomPaths {
+		p.addSource(cp.Path, label("path"))
+	}
+	for _, cp := range p.CreatePaths {
+		if cp.Exec {
+			p.addSource(cp.Path, label("rwx-create"))
+		} else {
+			p.addSource(cp.Path, label("rw-create"))
+		}
+	}
+	for _, port := range p.BindTCPPorts {
+		p.addSource(fmt.Sprintf("bind-tcp:%d", port), label("bind-tcp"))
+	}
+	for _, port := range p.ConnectTCPPorts {
+		p.addSource(fmt.Sprintf("connect-tcp:%d", port), label("connect-tcp"))
+	}
+}
+
+func (p *Profile) addSource(key, source string) {
+	if p.Sources == nil {
+		p.Sources = map[string][]string{}
+	}
+	for _, s := range p.Sources[key] {
+		if s == source {
+			return
+		}
+	}
+	p.Sources[key] = append(p.Sources[key], source)
+}
+
+// SandboxConfig converts the profile into a sandbox configuration. As on the
+// command line, --rox paths are also readable and --rwx paths also writable.
+func (p *Profile) SandboxConfig() sandbox.Config {
+	readOnlyPaths := append([]string{}, p.ReadOnlyPaths...)
+	readOnlyPaths = append(readOnlyPaths, p.ReadOnlyExecutablePaths...)
+
+	readWritePaths := append([]string{}, p.ReadWritePaths...)
+	readWritePaths = append(readWritePaths, p.ReadWriteExecutablePaths...)
+
+	cfg := sandbox.Config{
+		ReadOnlyPaths:            readOnlyPaths,
+		ReadWritePaths:           readWritePaths,
+		ReadOnlyExecutablePaths:  append([]string{}, p.ReadOnlyExecutablePaths...),
+		ReadWriteExecutablePaths: append([]string{}, p.ReadWriteExecutablePaths...),
+		CustomPaths:              append([]sandbox.CustomPath{}, p.CustomPaths...),
+		DenyPaths:                append([]string{}, p.DenyPaths...),
+		CreatePaths:              append([]sandbox.CreatePath{}, p.CreatePaths...),
+		MissingPaths:             p.MissingPaths,
+		BindTCPPorts:             append([]int{}, p.BindTCPPorts...),
+		ConnectTCPPorts:          append([]int{}, p.ConnectTCPPorts...),
+		AllowSocketFamilies:      append([]string{}, p.AllowSocketFamilies...),
+		DenySocketFamilies:       append([]string{}, p.DenySocketFamilies...),
+		NoUDP:                    Enabled(p.NoUDP),
+		BestEffort:               Enabled(p.BestEffort),
+		UnrestrictedFilesystem:   Enabled(p.UnrestrictedFilesystem),
+		UnrestrictedNetwork:      Enabled(p.UnrestrictedNetwork),
+		ScopeAbstractUnix:        Enabled(p.ScopeAbstractUnix),
+		ScopeSignal:              Enabled(p.ScopeSignal),
+		FailOnEmptyGlob:          Enabled(p.FailEmptyGlob),
+	}
+	for key, sources := range p.Sources {
+		for _, source := range sources {
+			cfg.AddSource(key, source)
+		}
+	}
+	return cfg
+}
+
+// ResourceLimits returns the resource limits of the profile in a stable
+// order.
+func (p *Profile) ResourceLimits() []rlimit.Limit {
+	var limits []rlimit.Limit
+	for _, name := range rlimit.Names() {
+		if l, ok := p.Limits[name]; ok {
+			limits = append(limits, l)
+		}
+	}
+	return limits
+}
+
+// EnvSpec returns the description of the command's environment.
+func (p *Profile) EnvSpec() env.Spec {
+	return env.Spec{
+		Inherit:  Enabled(p.InheritEnv),
+		Preset:   p.EnvPreset,
+		Patterns: append([]string{}, p.EnvPatterns...),
+		Unset:    append([]string{}, p.UnsetEnv...),
+		Files:    append([]string{}, p.EnvFiles...),
+		Vars:     append([]string{}, p.Env...),
+		Strict:   Enabled(p.EnvStrict),
+	}
+}
+
+// SeccompPolicy returns the syscall filtering policy of the profile.
+func (p *Profile) SeccompPolicy() seccomp.Policy {
+	return seccomp.Policy{
+		Mode:   p.Seccomp,
+		Deny:   append([]string{}, p.SeccompDeny...),
+		Allow:  append([]string{}, p.SeccompAllow...),
+		Action: p.SeccompAction,
+
+		ProfilePath: p.SeccompProfile,
+	}
+}
+
+func (p *Profile) limitSpec(name string) string {
+	if l, ok := p.Limits[name]; ok {
+		return l.String()
+	}
+	return ""
+}
+
+// Enabled reports whether an optional boolean option is set to true.
+func Enabled(b *bool) bool {
+	return b != nil && *b
+}
+
+func mergeBool(dst **bool, src *bool) {
+	if src != nil {
+		v := *src
+		*dst = &v
+	}
+}
+
+func stringList(field func(p *Profile) *[]string) keySetter {
+	return func(p *Profile, key string, v interface{}) error {
+		items, err := asList(key, v)
+		if err != nil {
+			return err
+		}
+		dst := field(p)
+		for i, item := range items {
+			s, err := asString(fmt.Sprintf("%s[%d]", key, i), item)
+			if err != nil {
+				return err
+			}
+			*dst = append(*dst, s)
+		}
+		return nil
+	}
+}
+
+// socketFamilies decodes a list of socket address family names, stored in
+// their canonical form.
+func socketFamilies(field func(p *Profile) *[]string) keySetter {
+	return func(p *Profile, key string, v interface{}) error {
+		items, err := asList(key, v)
+		if err != nil {
+			return err
+		}
+		dst := field(p)
+		for i, item := range items {
+			itemKey := fmt.Sprintf("%s[%d]", key, i)
+			s, err := asString(itemKey, item)
+			if err != nil {
+				return err
+			}
+			family, err := seccomp.ParseSocketFamily(s)
+			if err != nil {
+				return &KeyError{Key: itemKey, Err: err}
+			}
+			*dst = append(*dst, family)
+		}
+		return nil
+	}
+}
+
+// customPaths decodes a list of PATH:RIGHTS strings.
+func customPaths(p *Profile, key string, v interface{}) error {
+	items, err := asList(key, v)
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		itemKey := fmt.Sprintf("%s[%d]", key, i)
+		s, err := asString(itemKey, item)
+		if err != nil {
+			return err
+		}
+		cp, err := sandbox.ParseCustomPath(s)
+		if err != nil {
+			return &KeyError{Key: itemKey, Err: err}
+		}
+		p.CustomPaths = append(p.CustomPaths, cp)
+	}
+	return nil
+}
+
+// createPaths decodes a list of PATH[:MODE] strings for rw-create or
+// rwx-create.
+func createPaths(exec bool) keySetter {
+	return func(p *Profile, key string, v interface{}) error {
+		items, err := asList(key, v)
+		if err != nil {
+			return err
+		}
+		for i, item := range items {
+			itemKey := fmt.Sprintf("%s[%d]", key, i)
+			s, err := asString(itemKey, item)
+			if err != nil {
+				return err
+			}
+			cp, err := sandbox.ParseCreatePath(s, exec)
+			if err != nil {
+				return &KeyError{Key: itemKey, Err: err}
+			}
+			p.CreatePaths = append(p.CreatePaths, cp)
+		}
+		return nil
+	}
+}
+
+func (p *Profile) createPathSpecs(exec bool) []string {
+	var specs []string
+	for _, cp := range p.CreatePaths {
+		if cp.Exec == exec {
+			specs = append(specs, cp.String())
+		}
+	}
+	return specs
+}
+
+func (p *Profile) customPathSpecs() []string {
+	var specs []string
+	for _, cp := range p.CustomPaths {
+		specs = append(specs, cp.String())
+	}
+	return specs
+}
+
+// variables decodes a table of variable names to string values.
+func variables(p *Profile, key string, v interface{}) error {
+	table, ok := v.(map[string]interface{})
+	if !ok {
+		return &KeyError{Key: key, Err: fmt.Errorf("expected table, got %s", typeName(v))}
+	}
+	if p.Vars == nil {
+		p.Vars = map[string]string{}
+	}
+	for name, value := range table {
+		if !varName.MatchString(name) {
+			return &KeyError{Key: key + "." + name, Err: errors.New("invalid variable name")}
+		}
+		s, err := asString(key+"."+name, value)
+		if err != nil {
+			return err
+		}
+		p.Vars[name] = s
+	}
+	return nil
+}
+
+// varName matches names that can be referenced as $NAME.
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// portList decodes a list of TCP ports given as numbers or as strings in
+// the syntax accepted by sandbox.ParsePorts.
+func portList(field func(p *Profile) *[]int) keySetter {
+	return func(p *Profile, key string, v interface{}) error {
+		items, err := asList(key, v)
+		if err != nil {
+			return err
+		}
+		dst := field(p)
+		for i, item := range items {
+			itemKey := fmt.Sprintf("%s[%d]", key, i)
+			if spec, ok := item.(string); ok {
+				ports, err := sandbox.ParsePorts(spec)
+				if err != nil {
+					return &KeyError{Key: itemKey, Err: err}
+				}
+				*dst = append(*dst, ports...)
+				continue
+			}
+			n, err := asInt(itemKey, item)
+			if err != nil {
+				return err
+			}
+			if err := sandbox.ValidatePort(n); err != nil {
+				return &KeyError{Key: itemKey, Err: err}
+			}
+			*dst = append(*dst, n)
+		}
+		return nil
+	}
+}
+
+// str decodes a string option.
+func str(field func(p *Profile) *string) keySetter {
+	return validString(field, func(string) error { return nil })
+}
+
+// validString decodes a string option and checks it with validate.
+func validString(field func(p *Profile) *string, validate func(string) error) keySetter {
+	return func(p *Profile, key string, v interface{}) error {
+		s, err := asString(key, v)
+		if err != nil {
+			return err
+		}
+		if err := validate(s); err != nil {
+			return &KeyError{Key: key, Err: err}
+		}
+		*field(p) = s
+		return nil
+	}
+}
+
+// limit decodes a resource limit given as a string such as "512M" or as a
+// plain integer.
+func limit(name string) keySetter {
+	return func(p *Profile, key string, v interface{}) error {
+		var spec string
+		switch v := v.(type) {
+		case string:
+			spec = v
+		case int, int64, uint64, json.Number:
+			spec = fmt.Sprint(v)
+		default:
+			return &KeyError{Key: key, Err: fmt.Errorf("expected string or integer, got %s", typeName(v))}
+		}
+		l, err := rlimit.Parse(name, spec)
+		if err != nil {
+			return &KeyError{Key: key, Err: err}
+		}
+		if p.Limits == nil {
+			p.Limits = map[string]rlimit.Limit{}
+		}
+		p.Limits[name] = l
+		return nil
+	}
+}
+
+func boolean(field func(p *Profile) **bool) keySetter {
+	return func(p *Profile, key string, v interface{}) error {
+		b, ok := v.(bool)
+		if !ok {
+			return &KeyError{Key: key, Err: fmt.Errorf("expected boolean, got %s", typeName(v))}
+		}
+		*field(p) = &b
+		return nil
+	}
+}
+
+func asList(key string, v interface{}) ([]interface{}, error) {
+	switch v := v.(type) {
+	case []interface{}:
+		return v, nil
+	case []map[string]interface{}:
+		// TOML arrays of tables; never valid for list keys.
+		return nil, &KeyError{Key: key, Err: errors.New("expected list of values, got list of tables")}
+	}
+	return nil, &KeyError{Key: key, Err: fmt.Errorf("expected list, got %s", typeName(v))}
+}
+
+func asString(key string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", &KeyError{Key: key, Err: fmt.Errorf("expected string, got %s", typeName(v))}
+	}
+	return s, nil
+}
+
+func asInt(key string, v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		if n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int(n), nil
+		}
+		return 0, &KeyError{Key: key, Err: fmt.Errorf("integer %d out of range", n)}
+	case uint64:
+		if n <= math.MaxInt32 {
+			return int(n), nil
+		}
+		return 0, &KeyError{Key: key, Err: fmt.Errorf("integer %d out of range", n)}
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, &KeyError{Key: key, Err: fmt.Errorf("expected integer, got %s", n)}
+		}
+		return asInt(key, i)
+	}
+	return 0, &KeyError{Key: key, Err: fmt.Errorf("expected integer, got %s", typeName(v))}
+}
+
+// typeName describes the type of a decoded value for error messages.
+func typeName(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "float"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "float"
+	case []interface{}, []map[string]interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "table"
+	}
+	return fmt.Sprintf("%T", v)
+}
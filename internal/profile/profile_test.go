@@ -0,0 +1,207 @@
+package profile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"github.com/zouuup/landrun/internal/rlimit"
+	"github.com/zouuup/landrun/internal/sandbox"
+)
+
+func TestParseFormats(t *testing.T) {
+	docs := map[string]string{
+		"p.toml": `
+ro = ["/etc"]
+rox = ["/usr"]
+bind-tcp = [8080]
+best-effort = true
+env = ["HOME"]
+`,
+		"p.yaml": `
+ro: [/etc]
+rox: [/usr]
+bind-tcp: [8080]
+best-effort: true
+env: [HOME]
+`,
+		"p.json": `{"ro": ["/etc"], "rox": ["/usr"], "bind-tcp": [8080], "best-effort": true, "env": ["HOME"]}`,
+	}
+
+	for name, doc := range docs {
+		p, err := Parse(name, []byte(doc))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !reflect.DeepEqual(p.ReadOnlyPaths, []string{"/etc"}) {
+			t.Errorf("%s: ro = %v", name, p.ReadOnlyPaths)
+		}
+		if !reflect.DeepEqual(p.ReadOnlyExecutablePaths, []string{"/usr"}) {
+			t.Errorf("%s: rox = %v", name, p.ReadOnlyExecutablePaths)
+		}
+		if !reflect.DeepEqual(p.BindTCPPorts, []int{8080}) {
+			t.Errorf("%s: bind-tcp = %v", name, p.BindTCPPorts)
+		}
+		if !Enabled(p.BestEffort) {
+			t.Errorf("%s: expected best-effort to be set", name)
+		}
+		if p.Ldd != nil {
+			t.Errorf("%s: expected ldd to be unset", name)
+		}
+		if !reflect.DeepEqual(p.Env, []string{"HOME"}) {
+			t.Errorf("%s: env = %v", name, p.Env)
+		}
+	}
+}
+
+func TestParseErrorsNameFileAndKey(t *testing.T) {
+	cases := []struct {
+		name, doc, want string
+	}{
+		{"bad.toml", `rw = ["/tmp", 3]`, `bad.toml: key "rw[1]": expected string, got integer`},
+		{"bad.yaml", "best-effort: yes please\n", `bad.yaml: key "best-effort": expected boolean, got string`},
+		{"bad.json", `{"connect-tcp": "443"}`, `bad.json: key "connect-tcp": expected list, got string`},
+		{"bad.json", `{"rox": ["/usr"], "rwxx": []}`, `bad.json: key "rwxx": unknown key`},
+		{"bad.json", "{\n\"ro\": [,]}", `bad.json: line 2:`},
+		{"bad.toml", `path = ["/srv:read,fly"]`, `bad.toml: key "path[0]": invalid path rule "/srv:read,fly": unknown access right "fly"`},
+		{"bad.yaml", "vars:\n  DATA-DIR: /srv\n", `bad.yaml: key "vars.DATA-DIR": invalid variable name`},
+		{"bad.toml", `bind-tcp = [80, 70000]`, `bad.toml: key "bind-tcp[1]": port 70000 out of range (0-65535)`},
+		{"bad.json", `{"connect-tcp": ["443", "10-5"]}`, `bad.json: key "connect-tcp[1]": invalid port range "10-5"`},
+		{"bad.toml", `missing-paths = "ignore"`, `bad.toml: key "missing-paths": invalid missing path policy "ignore"`},
+		{"bad.yaml", "rw-create: [/srv/cache/:rwx]\n", `bad.yaml: key "rw-create[0]": invalid mode "rwx"`},
+		{"bad.toml", `limit-as = "lots"`, `bad.toml: key "limit-as": invalid as limit "lots"`},
+		{"bad.json", `{"limit-nofile": true}`, `bad.json: key "limit-nofile": expected string or integer, got boolean`},
+		{"bad.yaml", "seccomp: strict\n", `bad.yaml: key "seccomp": invalid seccomp mode "strict"`},
+		{"bad.toml", `deny-socket-family = ["inet6", "smoke"]`, `bad.toml: key "deny-socket-family[1]": unknown socket family "smoke"`},
+		{"bad.json", `{"seccomp-profile": ["a.json"]}`, `bad.json: key "seccomp-profile": expected string, got list`},
+		{"bad.yaml", "env-preset: full\n", `bad.yaml: key "env-preset": unknown environment preset "full"`},
+		{"bad.json", `{"ldd-heuristics": "on"}`, `bad.json: key "ldd-heuristics": expected boolean, got string`},
+		{"bad.ini", ``, `unsupported profile format ".ini"`},
+	}
+
+	for _, tc := range cases {
+		_, err := Parse(tc.name, []byte(tc.doc))
+		if err == nil {
+			t.Fatalf("%s: expected error for %q", tc.name, tc.doc)
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %q does not contain %q", tc.name, err, tc.want)
+		}
+	}
+
+	_, err := Parse("bad.toml", []byte(`ro = "/etc"`))
+	var keyErr *KeyError
+	if !errors.As(err, &keyErr) || keyErr.Key != "ro" {
+		t.Errorf("expected KeyError for key ro, got %v", err)
+	}
+}
+
+func TestMergeAndSandboxConfig(t *testing.T) {
+	yes, no := true, false
+	base := &Profile{
+		ReadOnlyPaths:           []string{"/etc"},
+		ReadOnlyExecutablePaths: []string{"/usr"},
+		BestEffort:              &yes,
+		Ldd:                     &yes,
+	}
+	base.Merge(&Profile{
+		ReadWriteExecutablePaths: []string{"/tmp"},
+		CustomPaths:              []sandbox.CustomPath{{Path: "/var/spool", Access: syscall.AccessFSMakeReg | syscall.AccessFSWriteFile}},
+		ConnectTCPPorts:          []int{443},
+		Ldd:                      &no,
+	})
+
+	if !Enabled(base.BestEffort) {
+		t.Errorf("best-effort should survive a merge that doesn't set it")
+	}
+	if Enabled(base.Ldd) {
+		t.Errorf("ldd should be overridden by the merged profile")
+	}
+
+	cfg := base.SandboxConfig()
+	if !reflect.DeepEqual(cfg.ReadOnlyPaths, []string{"/etc", "/usr"}) {
+		t.Errorf("ReadOnlyPaths = %v", cfg.ReadOnlyPaths)
+	}
+	if !reflect.DeepEqual(cfg.ReadWritePaths, []string{"/tmp"}) {
+		t.Errorf("ReadWritePaths = %v", cfg.ReadWritePaths)
+	}
+	if !reflect.DeepEqual(cfg.ReadWriteExecutablePaths, []string{"/tmp"}) {
+		t.Errorf("ReadWriteExecutablePaths = %v", cfg.ReadWriteExecutablePaths)
+	}
+	if !reflect.DeepEqual(cfg.ConnectTCPPorts, []int{443}) || !cfg.BestEffort {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sandbox.yml")
+	if err := os.WriteFile(path, []byte("rox: [/usr]\nadd-exec: true\nlimit-nofile: 256\n"), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !Enabled(p.AddExec) || len(p.ReadOnlyExecutablePaths) != 1 {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	if limits := p.ResourceLimits(); len(limits) != 1 || limits[0].String() != "256" {
+		t.Errorf("unexpected limits %v", limits)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	yes := true
+	p := &Profile{
+		Description:              "round trip",
+		ReadOnlyPaths:            []string{"/etc"},
+		ReadWriteExecutablePaths: []string{"/tmp"},
+		CustomPaths:              []sandbox.CustomPath{{Path: "/var/spool", Access: syscall.AccessFSMakeReg | syscall.AccessFSWriteFile}},
+		ConnectTCPPorts:          []int{443},
+		DenySocketFamilies:       []string{"netlink", "packet"},
+		NoUDP:                    &yes,
+		Ldd:                      &yes,
+		LddHeuristics:            &yes,
+		Vars:                     map[string]string{"DATA": "/srv/data"},
+		CreatePaths:              []sandbox.CreatePath{{Path: "/srv/cache", Dir: true, Mode: 0700}, {Path: "/srv/bin", Dir: true, Mode: 0755, Exec: true}},
+		MissingPaths:             sandbox.MissingWarn,
+		Seccomp:                  "default",
+		SeccompAllow:             []string{"ptrace"},
+		SeccompAction:            "kill",
+		SeccompProfile:           "/etc/landrun/seccomp.json",
+		Env:                      []string{"PATH=/opt/bin:${PATH}"},
+		EnvFiles:                 []string{"/etc/landrun/app.env"},
+		EnvPatterns:              []string{"LC_*"},
+		UnsetEnv:                 []string{"AWS_*"},
+		InheritEnv:               &yes,
+		EnvPreset:                "minimal",
+		Limits:                   map[string]rlimit.Limit{"as": {Name: "as", Value: 512 << 20}, "cpu": {Name: "cpu", Value: 30}},
+	}
+	for _, name := range []string{"out.toml", "out.yaml", "out.json"} {
+		data, err := p.Encode(name)
+		if err != nil {
+			t.Fatalf("%s: Encode failed: %v", name, err)
+		}
+		got, err := Parse(name, data)
+		if err != nil {
+			t.Fatalf("%s: Parse of encoded profile failed: %v\n%s", name, err, data)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("%s: round trip mismatch:\n got %+v\nwant %+v", name, got, p)
+		}
+	}
+}
+
+func TestParsePortSpecs(t *testing.T) {
+	p, err := Parse("p.toml", []byte(`connect-tcp = [443, "8000-8002"]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !reflect.DeepEqual(p.ConnectTCPPorts, []int{443, 8000, 8001, 8002}) {
+		t.Errorf("connect-tcp = %v", p.ConnectTCPPorts)
+	}
+}
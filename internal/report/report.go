@@ -0,0 +1,258 @@
+// Package report writes the machine-readable record of a supervised run:
+// how the command was sandboxed and how it ended.
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zouuup/landrun/internal/exec"
+	"github.com/zouuup/landrun/internal/rlimit"
+	"github.com/zouuup/landrun/internal/sandbox"
+	"github.com/zouuup/landrun/internal/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+// Report is the JSON document written by --report.
+type Report struct {
+	Version string   `json:"landrun_version"`
+	Argv    []string `json:"argv"`
+	Binary  Binary   `json:"binary"`
+	// Env lists the names of the variables passed to the command; their
+	// values may be secrets.
+	Env      []string `json:"env"`
+	Landlock Landlock `json:"landlock"`
+	Rules    Rules    `json:"rules"`
+	Limits   []Limit  `json:"limits"`
+	Seccomp  Seccomp  `json:"seccomp"`
+
+	Started         time.Time `json:"started"`
+	Ended           time.Time `json:"ended"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Rusage          Rusage    `json:"rusage"`
+	Exit            Exit      `json:"exit"`
+}
+
+// Binary is the executed file.
+type Binary struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Landlock describes the Landlock support used for the run.
+type Landlock struct {
+	KernelABI   int  `json:"kernel_abi"`
+	EnforcedABI int  `json:"enforced_abi"`
+	BestEffort  bool `json:"best_effort"`
+	// Downgrades are the restrictions left out because the kernel doesn't
+	// support them.
+	Downgrades []string `json:"downgrades"`
+}
+
+// Rules are the effective Landlock rules, after presets, variables, glob
+// patterns and library dependencies were expanded.
+type Rules struct {
+	RestrictFilesystem bool       `json:"restrict_filesystem"`
+	RestrictNetwork    bool       `json:"restrict_network"`
+	Paths              []PathRule `json:"paths"`
+	Ports              []PortRule `json:"ports"`
+	Scopes             []string   `json:"scopes"`
+	Warnings           []string   `json:"warnings"`
+}
+
+// PathRule is a filesystem rule.
+type PathRule struct {
+	Path    string   `json:"path"`
+	Dir     bool     `json:"dir"`
+	Access  []string `json:"access"`
+	Sources []string `json:"sources,omitempty"`
+	Create  bool     `json:"create,omitempty"`
+}
+
+// PortRule is a TCP port rule.
+type PortRule struct {
+	Port    int      `json:"port"`
+	Access  []string `json:"access"`
+	Sources []string `json:"sources,omitempty"`
+}
+
+// Limit is a resource limit of the command.
+type Limit struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Seccomp describes the syscall filters of the command.
+type Seccomp struct {
+	Mode    string   `json:"mode,omitempty"`
+	Deny    []string `json:"deny,omitempty"`
+	Allow   []string `json:"allow,omitempty"`
+	Action  string   `json:"action,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	Sockets string   `json:"sockets,omitempty"`
+}
+
+// Rusage is the resource usage of the command, as reported by wait4.
+type Rusage struct {
+	UserSeconds                float64 `json:"user_seconds"`
+	SystemSeconds              float64 `json:"system_seconds"`
+	MaxRSSKiB                  int64   `json:"max_rss_kib"`
+	MinorFaults                int64   `json:"minor_faults"`
+	MajorFaults                int64   `json:"major_faults"`
+	InputBlocks                int64   `json:"input_blocks"`
+	OutputBlocks               int64   `json:"output_blocks"`
+	VoluntaryContextSwitches   int64   `json:"voluntary_context_switches"`
+	InvoluntaryContextSwitches int64   `json:"involuntary_context_switches"`
+}
+
+// Exit is how the command ended. Code is 128 plus the signal number if it
+// was killed by a signal.
+type Exit struct {
+	Code   int    `json:"code"`
+	Signal string `json:"signal,omitempty"`
+}
+
+// Run is what a report is built from.
+type Run struct {
+	Version string
+	Args    []string
+	// Binary is the resolved path of the command and BinarySHA256 its
+	// hash, see Hash.
+	Binary       string
+	BinarySHA256 string
+	Env          []string
+	Ruleset      *sandbox.Ruleset
+	Limits       []rlimit.Limit
+	Seccomp      seccomp.Policy
+	Status       exec.Status
+}
+
+// Hash returns the hex-encoded SHA-256 of the file at path. The binary is
+// hashed before the command is started, so that the hash is the one of the
+// executed file even if it is replaced during the run.
+func Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// New builds the report of run.
+func New(run Run) *Report {
+	rs := run.Ruleset
+	if abs, err := filepath.Abs(run.Binary); err == nil {
+		run.Binary = abs
+	}
+	r := &Report{
+		Version: run.Version,
+		Argv:    run.Args,
+		Binary:  Binary{Path: run.Binary, SHA256: run.BinarySHA256},
+		Env:     []string{},
+		Landlock: Landlock{
+			KernelABI:   sandbox.ABIVersion(),
+			EnforcedABI: rs.EnforcedABI(),
+			BestEffort:  rs.BestEffort,
+			Downgrades:  append([]string{}, rs.Downgrades...),
+		},
+		Rules: Rules{
+			RestrictFilesystem: rs.RestrictFilesystem,
+			RestrictNetwork:    rs.RestrictNetwork,
+			Paths:              []PathRule{},
+			Ports:              []PortRule{},
+			Scopes:             []string{},
+			Warnings:           append([]string{}, rs.Warnings...),
+		},
+		Limits: []Limit{},
+		Seccomp: Seccomp{
+			Mode:    run.Seccomp.Mode,
+			Deny:    run.Seccomp.Deny,
+			Allow:   run.Seccomp.Allow,
+			Profile: run.Seccomp.ProfilePath,
+		},
+		Started:         run.Status.Started,
+		Ended:           run.Status.Ended,
+		DurationSeconds: run.Status.Ended.Sub(run.Status.Started).Seconds(),
+		Rusage:          newRusage(&run.Status.Rusage),
+		Exit:            Exit{Code: run.Status.Code},
+	}
+	for _, kv := range run.Env {
+		name, _, _ := strings.Cut(kv, "=")
+		r.Env = append(r.Env, name)
+	}
+	if rs.ScopeAbstractUnix {
+		r.Rules.Scopes = append(r.Rules.Scopes, "abstract-unix")
+	}
+	if rs.ScopeSignal {
+		r.Rules.Scopes = append(r.Rules.Scopes, "signal")
+	}
+	for _, p := range rs.Paths {
+		r.Rules.Paths = append(r.Rules.Paths, PathRule{
+			Path:    p.Path,
+			Dir:     p.Dir,
+			Access:  sandbox.AccessFSNames(p.Access),
+			Sources: p.Sources,
+			Create:  p.Create,
+		})
+	}
+	for _, p := range rs.Ports {
+		r.Rules.Ports = append(r.Rules.Ports, PortRule{
+			Port:    p.Port,
+			Access:  strings.Split(strings.Trim(p.Access.String(), "{}"), ","),
+			Sources: p.Sources,
+		})
+	}
+	for _, l := range run.Limits {
+		r.Limits = append(r.Limits, Limit{Name: l.Name, Value: l.String()})
+	}
+	if run.Seccomp.Mode != "" {
+		r.Seccomp.Action = run.Seccomp.Action
+		if r.Seccomp.Action == "" {
+			r.Seccomp.Action = seccomp.ActionErrno
+		}
+	}
+	if run.Seccomp.Sockets.Enabled() {
+		r.Seccomp.Sockets = run.Seccomp.Sockets.String()
+	}
+	if run.Status.Signal != 0 {
+		r.Exit.Signal = unix.SignalName(run.Status.Signal)
+	}
+	return r
+}
+
+func newRusage(ru *unix.Rusage) Rusage {
+	seconds := func(tv unix.Timeval) float64 {
+		return float64(tv.Sec) + float64(tv.Usec)/1e6
+	}
+	return Rusage{
+		UserSeconds:                seconds(ru.Utime),
+		SystemSeconds:              seconds(ru.Stime),
+		MaxRSSKiB:                  ru.Maxrss,
+		MinorFaults:                ru.Minflt,
+		MajorFaults:                ru.Majflt,
+		InputBlocks:                ru.Inblock,
+		OutputBlocks:               ru.Oublock,
+		VoluntaryContextSwitches:   ru.Nvcsw,
+		InvoluntaryContextSwitches: ru.Nivcsw,
+	}
+}
+
+// Write writes the report to path as indented JSON.
+func (r *Report) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,118 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/landlock-lsm/go-landlock/landlock"
+	llsyscall "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"github.com/zouuup/landrun/internal/exec"
+	"github.com/zouuup/landrun/internal/rlimit"
+	"github.com/zouuup/landrun/internal/sandbox"
+	"github.com/zouuup/landrun/internal/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+func TestHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bin")
+	if err := os.WriteFile(path, []byte("abc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Hash(path)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; sum != want {
+		t.Errorf("Hash = %s, want %s", sum, want)
+	}
+	if _, err := Hash(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestNew(t *testing.T) {
+	started := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := New(Run{
+		Version:      "1.0",
+		Args:         []string{"app", "--serve"},
+		Binary:       "/usr/bin/app",
+		BinarySHA256: "00ff",
+		Env:          []string{"PATH=/usr/bin", "TOKEN=secret"},
+		Ruleset: &sandbox.Ruleset{
+			Paths: []sandbox.PathRule{{
+				Path:    "/usr",
+				Dir:     true,
+				Access:  landlock.AccessFSSet(llsyscall.AccessFSExecute | llsyscall.AccessFSReadFile),
+				Sources: []string{"--rox"},
+			}},
+			Ports:              []sandbox.PortRule{{Port: 443, Access: llsyscall.AccessNetConnectTCP}},
+			RestrictFilesystem: true,
+			RestrictNetwork:    true,
+			ScopeSignal:        true,
+			BestEffort:         true,
+			Downgrades:         []string{"truncate on /tmp (requires Landlock ABI v3)"},
+		},
+		Limits:  []rlimit.Limit{{Name: "nofile", Value: 64}},
+		Seccomp: seccomp.Policy{Mode: seccomp.ModeDefault, Deny: []string{"ptrace"}},
+		Status: exec.Status{
+			Code:    128 + int(syscall.SIGTERM),
+			Signal:  syscall.SIGTERM,
+			Started: started,
+			Ended:   started.Add(1500 * time.Millisecond),
+			Rusage:  unix.Rusage{Utime: unix.Timeval{Sec: 1, Usec: 250000}, Maxrss: 2048},
+		},
+	})
+
+	if !reflect.DeepEqual(r.Env, []string{"PATH", "TOKEN"}) {
+		t.Errorf("env = %v, want only the names", r.Env)
+	}
+	if r.Binary != (Binary{Path: "/usr/bin/app", SHA256: "00ff"}) {
+		t.Errorf("binary = %+v", r.Binary)
+	}
+	if !r.Landlock.BestEffort || len(r.Landlock.Downgrades) != 1 {
+		t.Errorf("landlock = %+v", r.Landlock)
+	}
+	wantPaths := []PathRule{{Path: "/usr", Dir: true, Access: []string{"execute", "read_file"}, Sources: []string{"--rox"}}}
+	if !reflect.DeepEqual(r.Rules.Paths, wantPaths) {
+		t.Errorf("paths = %+v, want %+v", r.Rules.Paths, wantPaths)
+	}
+	if len(r.Rules.Ports) != 1 || !reflect.DeepEqual(r.Rules.Ports[0].Access, []string{"connect_tcp"}) {
+		t.Errorf("ports = %+v", r.Rules.Ports)
+	}
+	if !reflect.DeepEqual(r.Rules.Scopes, []string{"signal"}) {
+		t.Errorf("scopes = %v", r.Rules.Scopes)
+	}
+	if !reflect.DeepEqual(r.Limits, []Limit{{Name: "nofile", Value: "64"}}) {
+		t.Errorf("limits = %+v", r.Limits)
+	}
+	if r.Seccomp.Action != seccomp.ActionErrno {
+		t.Errorf("seccomp = %+v", r.Seccomp)
+	}
+	if r.DurationSeconds != 1.5 || r.Rusage.UserSeconds != 1.25 || r.Rusage.MaxRSSKiB != 2048 {
+		t.Errorf("unexpected timings %v, %+v", r.DurationSeconds, r.Rusage)
+	}
+	if r.Exit != (Exit{Code: 143, Signal: "SIGTERM"}) {
+		t.Errorf("exit = %+v", r.Exit)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := r.Write(path); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid report: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(&got, r) {
+		t.Errorf("report does not round trip:\n got %+v\nwant %+v", got, r)
+	}
+}
@@ -0,0 +1,241 @@
+// Package rlimit parses and applies the resource limits landrun sets on the
+// sandboxed command with setrlimit.
+package rlimit
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zouuup/landrun/internal/log"
+	"golang.org/x/sys/unix"
+)
+
+// Unlimited is the value of a limit that doesn't restrict the resource.
+const Unlimited = unix.RLIM_INFINITY
+
+// kind is the unit a limit is expressed in.
+type kind int
+
+const (
+	kindSize kind = iota
+	kindSeconds
+	kindCount
+)
+
+type resourceInfo struct {
+	name     string
+	resource int
+	kind     kind
+	desc     string
+}
+
+// syntax describes the values accepted for each kind in error messages.
+var syntax = map[kind]string{
+	kindSize:    "a size such as 512M",
+	kindSeconds: "a duration of at least one second such as 30s or 5m",
+	kindCount:   "a number",
+}
+
+// resources lists the supported limits, in the order they are reported.
+var resources = []resourceInfo{
+	{"as", unix.RLIMIT_AS, kindSize, "address space"},
+	{"cpu", unix.RLIMIT_CPU, kindSeconds, "CPU time"},
+	{"nofile", unix.RLIMIT_NOFILE, kindCount, "open files"},
+	{"nproc", unix.RLIMIT_NPROC, kindCount, "processes of the user"},
+	{"fsize", unix.RLIMIT_FSIZE, kindSize, "file size"},
+	{"core", unix.RLIMIT_CORE, kindSize, "core file size"},
+	{"stack", unix.RLIMIT_STACK, kindSize, "stack size"},
+}
+
+// sizeUnits are the suffixes accepted for sizes, in powers of 1024.
+var sizeUnits = []struct {
+	suffix string
+	factor uint64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// Limit is a resource limit. Both the soft and the hard limit are set to
+// Value so that the command cannot raise it again, except that the hard CPU
+// time limit is one second higher: the command gets SIGXCPU when it reaches
+// Value and is killed a second later.
+type Limit struct {
+	Name  string
+	Value uint64
+}
+
+// Names returns the names of the supported limits.
+func Names() []string {
+	names := make([]string, len(resources))
+	for i, r := range resources {
+		names[i] = r.name
+	}
+	return names
+}
+
+// Describe returns a short description of the named limit.
+func Describe(name string) string {
+	if r, ok := lookup(name); ok {
+		return r.desc
+	}
+	return ""
+}
+
+func lookup(name string) (resourceInfo, bool) {
+	for _, r := range resources {
+		if r.name == name {
+			return r, true
+		}
+	}
+	return resourceInfo{}, false
+}
+
+// Parse parses the value of the named limit. Sizes are in bytes with an
+// optional K, M, G or T suffix (powers of 1024, "512M" or "512MiB"), CPU
+// time is in seconds or a duration such as "90s" or "5m", and counts are
+// plain numbers. "unlimited" lifts the limit.
+func Parse(name, value string) (Limit, error) {
+	r, ok := lookup(name)
+	if !ok {
+		return Limit{}, fmt.Errorf("unknown resource limit %q (expected one of %s)", name, strings.Join(Names(), ", "))
+	}
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "unlimited") {
+		return Limit{Name: name, Value: Unlimited}, nil
+	}
+
+	var v uint64
+	var err error
+	switch r.kind {
+	case kindSize:
+		v, err = parseSize(value)
+	case kindSeconds:
+		v, err = parseSeconds(value)
+	default:
+		v, err = strconv.ParseUint(value, 10, 64)
+	}
+	if err != nil || v == Unlimited {
+		return Limit{}, fmt.Errorf("invalid %s limit %q (expected %s or unlimited)", name, value, syntax[r.kind])
+	}
+	return Limit{Name: name, Value: v}, nil
+}
+
+func parseSize(s string) (uint64, error) {
+	upper := strings.ToUpper(s)
+	if strings.HasSuffix(upper, "IB") {
+		upper = strings.TrimSuffix(upper, "IB")
+	} else {
+		upper = strings.TrimSuffix(upper, "B")
+	}
+	factor := uint64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, factor = strings.TrimSuffix(upper, u.suffix), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseUint(upper, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n > Unlimited/factor {
+		return 0, fmt.Errorf("size %q overflows", s)
+	}
+	return n * factor, nil
+}
+
+func parseSeconds(s string) (uint64, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		if n == 0 {
+			return 0, fmt.Errorf("CPU time below one second")
+		}
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("CPU time below one second")
+	}
+	// RLIMIT_CPU has a resolution of one second; round up.
+	return uint64((d + time.Second - 1) / time.Second), nil
+}
+
+// String formats the value of the limit in the syntax accepted by Parse.
+func (l Limit) String() string {
+	if l.Value == Unlimited {
+		return "unlimited"
+	}
+	r, _ := lookup(l.Name)
+	switch r.kind {
+	case kindSize:
+		for _, u := range sizeUnits {
+			if l.Value >= u.factor && l.Value%u.factor == 0 {
+				return fmt.Sprintf("%d%s", l.Value/u.factor, u.suffix)
+			}
+		}
+	case kindSeconds:
+		return fmt.Sprintf("%ds", l.Value)
+	}
+	return strconv.FormatUint(l.Value, 10)
+}
+
+// Validate checks that the limits don't exceed the hard limits landrun
+// inherited, which an unprivileged process cannot raise.
+func Validate(limits []Limit) error {
+	for _, l := range limits {
+		r, ok := lookup(l.Name)
+		if !ok {
+			return fmt.Errorf("unknown resource limit %q", l.Name)
+		}
+		var cur unix.Rlimit
+		if err := unix.Getrlimit(r.resource, &cur); err != nil {
+			return fmt.Errorf("getrlimit(%s): %w", l.Name, err)
+		}
+		if cur.Max != Unlimited && l.Value > cur.Max {
+			return fmt.Errorf("%s limit %s exceeds the hard limit %s inherited by landrun", l.Name, l, Limit{Name: l.Name, Value: cur.Max})
+		}
+	}
+	return nil
+}
+
+// Apply sets the limits on the current process. They are inherited by the
+// command landrun executes.
+func Apply(limits []Limit) error {
+	for _, l := range limits {
+		r, ok := lookup(l.Name)
+		if !ok {
+			return fmt.Errorf("unknown resource limit %q", l.Name)
+		}
+		lim := unix.Rlimit{Cur: l.Value, Max: l.Value}
+		if r.kind == kindSeconds && l.Value != Unlimited {
+			var cur unix.Rlimit
+			if err := unix.Getrlimit(r.resource, &cur); err == nil && l.Value < cur.Max {
+				lim.Max = l.Value + 1
+			}
+		}
+		if err := unix.Setrlimit(r.resource, &lim); err != nil {
+			return fmt.Errorf("setrlimit(%s, %s): %w", l.Name, l, err)
+		}
+		log.Debug("Set %s limit to %s", l.Name, l)
+	}
+	return nil
+}
+
+// WriteText writes a human readable description of the limits.
+func WriteText(w io.Writer, limits []Limit) {
+	fmt.Fprintln(w, "Limits:")
+	if len(limits) == 0 {
+		fmt.Fprintln(w, "  inherited")
+	}
+	for _, l := range limits {
+		fmt.Fprintf(w, "  %s: %s (%s)\n", l.Name, l, Describe(l.Name))
+	}
+}
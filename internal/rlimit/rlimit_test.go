@@ -0,0 +1,69 @@
+package rlimit
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name, value string
+		want        uint64
+		str         string
+	}{
+		{"as", "512M", 512 << 20, "512M"},
+		{"as", "2GiB", 2 << 30, "2G"},
+		{"fsize", "1536k", 1536 << 10, "1536K"},
+		{"core", "0", 0, "0"},
+		{"stack", "8388608", 8 << 20, "8M"},
+		{"cpu", "30", 30, "30s"},
+		{"cpu", "1m30s", 90, "90s"},
+		{"cpu", "1500ms", 2, "2s"},
+		{"nofile", "256", 256, "256"},
+		{"nproc", "unlimited", Unlimited, "unlimited"},
+	}
+	for _, tc := range cases {
+		l, err := Parse(tc.name, tc.value)
+		if err != nil {
+			t.Errorf("%s=%s: %v", tc.name, tc.value, err)
+			continue
+		}
+		if l.Value != tc.want || l.String() != tc.str {
+			t.Errorf("%s=%s: got %d (%s), want %d (%s)", tc.name, tc.value, l.Value, l, tc.want, tc.str)
+		}
+	}
+
+	errors := map[[2]string]string{
+		{"as", "12X"}:             `invalid as limit "12X" (expected a size such as 512M or unlimited)`,
+		{"cpu", "0"}:              `invalid cpu limit "0"`,
+		{"cpu", "500ms"}:          `invalid cpu limit "500ms"`,
+		{"nofile", "-1"}:          `invalid nofile limit "-1" (expected a number or unlimited)`,
+		{"fsize", "99999999999T"}: `invalid fsize limit`,
+		{"memory", "1G"}:          `unknown resource limit "memory"`,
+	}
+	for in, want := range errors {
+		_, err := Parse(in[0], in[1])
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s=%s: expected error containing %q, got %v", in[0], in[1], want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var cur unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &cur); err != nil {
+		t.Fatalf("getrlimit: %v", err)
+	}
+	if err := Validate([]Limit{{Name: "nofile", Value: cur.Max}}); err != nil {
+		t.Errorf("limit at the hard limit rejected: %v", err)
+	}
+	if cur.Max == Unlimited {
+		t.Skip("RLIMIT_NOFILE has no hard limit")
+	}
+	err := Validate([]Limit{{Name: "nofile", Value: cur.Max + 1}})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the hard limit") {
+		t.Errorf("expected a hard limit error, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zouuup/landrun/internal/log"
+)
+
+// applyDeny removes access to the tree at deny from the rules in rs.
+//
+// Landlock can only grant access, and a rule on a directory covers its whole
+// subtree. A rule on an ancestor of deny is therefore replaced by rules with
+// the same rights on every existing entry next to the path leading down to
+// deny. The directories along that path get no rule of their own, so entries
+// created in them after the sandbox starts are not accessible and they can
+// no longer be listed or have entries added or removed. Rules on paths inside
+// the denied tree are kept.
+func applyDeny(rs *Ruleset, deny string) error {
+	deny = resolvePath(deny)
+
+	var kept, expand []PathRule
+	for _, r := range rs.Paths {
+		real := resolvePath(r.Path)
+		switch {
+		case real == deny:
+			log.Debug("Removing rule for %s: denied by --deny %s", r.Path, deny)
+		case r.Dir && isWithin(deny, real):
+			expand = append(expand, r)
+		default:
+			kept = append(kept, r)
+		}
+	}
+	if len(expand) == 0 {
+		log.Debug("Deny path %s is not covered by any rule", deny)
+		rs.Paths = kept
+		return nil
+	}
+
+	index := map[string]int{}
+	for i, r := range kept {
+		index[r.Path] = i
+	}
+	add := func(r PathRule) {
+		if i, ok := index[r.Path]; ok {
+			kept[i].Access |= r.Access
+			kept[i].Sources = appendUnique(kept[i].Sources, r.Sources...)
+			return
+		}
+		index[r.Path] = len(kept)
+		kept = append(kept, r)
+	}
+
+	source := "--deny " + deny
+	for _, r := range expand {
+		var dirs []string
+		for dir := resolvePath(r.Path); dir != deny; {
+			rel, err := filepath.Rel(dir, deny)
+			if err != nil {
+				return err
+			}
+			next := filepath.Join(dir, strings.SplitN(rel, "/", 2)[0])
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				if os.IsNotExist(err) {
+					break
+				}
+				return fmt.Errorf("--deny %s: cannot expand rule for %s: %w", deny, r.Path, err)
+			}
+			dirs = append(dirs, dir)
+			for _, e := range entries {
+				path := filepath.Join(dir, e.Name())
+				if path == next {
+					continue
+				}
+				if e.Type()&os.ModeSymlink != 0 {
+					// A rule on a symlink applies to its target.
+					target := resolvePath(path)
+					if target == deny || isWithin(target, deny) || isWithin(deny, target) {
+						rs.Warnings = append(rs.Warnings, fmt.Sprintf("--deny %s: not granting %s, it is a symlink to %s", deny, path, target))
+						continue
+					}
+				}
+				isDir := isDirectory(path)
+				access := r.Access
+				if !isDir {
+					access &= fileAccessRights
+				}
+				if access == 0 {
+					continue
+				}
+				add(PathRule{
+					Path:    path,
+					Dir:     isDir,
+					Access:  access,
+					Sources: appendUnique(append([]string{}, r.Sources...), source),
+				})
+			}
+			dir = next
+		}
+		if len(dirs) > 0 {
+			rs.Warnings = append(rs.Warnings, fmt.Sprintf(
+				"--deny %s: the rule for %s was split into rules for its existing entries; "+
+					"entries created later in %s are not accessible, and these directories cannot be listed or modified",
+				deny, r.Path, strings.Join(dirs, ", ")))
+		}
+	}
+	rs.Paths = kept
+	return nil
+}
+
+// resolvePath returns the absolute path with symlinks resolved, or the
+// cleaned absolute path if it cannot be resolved.
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return filepath.Clean(path)
+}
+
+// isWithin reports whether path is strictly below dir.
+func isWithin(path, dir string) bool {
+	if dir == "/" {
+		return path != "/" && strings.HasPrefix(path, "/")
+	}
+	return strings.HasPrefix(path, dir+"/")
+}
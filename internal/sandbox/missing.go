@@ -0,0 +1,132 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zouuup/landrun/internal/log"
+)
+
+// Policies for paths that don't exist when the sandbox is built.
+const (
+	MissingError = "error"
+	MissingWarn  = "warn"
+	MissingSkip  = "skip"
+)
+
+// OptionalPrefix marks a path that is skipped silently if it doesn't exist,
+// whatever the missing path policy.
+const OptionalPrefix = "?"
+
+// ValidateMissingPolicy checks a --missing-paths value.
+func ValidateMissingPolicy(policy string) error {
+	switch policy {
+	case "", MissingError, MissingWarn, MissingSkip:
+		return nil
+	}
+	return fmt.Errorf("invalid missing path policy %q (expected %s, %s or %s)", policy, MissingError, MissingWarn, MissingSkip)
+}
+
+// CreatePath is a read-write path that landrun creates before enforcing the
+// sandbox if it doesn't exist, as given with --rw-create or --rwx-create.
+type CreatePath struct {
+	Path string
+	Dir  bool
+	Mode os.FileMode
+	Exec bool
+}
+
+// ParseCreatePath parses a PATH[:MODE] specification. A trailing slash
+// requests a directory. MODE is octal and defaults to 0755 for directories
+// and 0644 for files.
+func ParseCreatePath(spec string, exec bool) (CreatePath, error) {
+	path := spec
+	mode := os.FileMode(0)
+	if i := strings.LastIndex(spec, ":"); i > 0 {
+		m, err := strconv.ParseUint(spec[i+1:], 8, 32)
+		if err != nil || m > 07777 {
+			return CreatePath{}, fmt.Errorf("invalid mode %q in %q, expected an octal mode such as 0750", spec[i+1:], spec)
+		}
+		path, mode = spec[:i], os.FileMode(m)
+	}
+	if path == "" {
+		return CreatePath{}, fmt.Errorf("invalid path %q", spec)
+	}
+	cp := CreatePath{Path: filepath.Clean(path), Dir: strings.HasSuffix(path, "/"), Mode: mode, Exec: exec}
+	if cp.Mode == 0 {
+		cp.Mode = 0644
+		if cp.Dir {
+			cp.Mode = 0755
+		}
+	}
+	return cp, nil
+}
+
+// String formats the path in the syntax accepted by ParseCreatePath.
+func (c CreatePath) String() string {
+	path := c.Path
+	if c.Dir && path != "/" {
+		path += "/"
+	}
+	return fmt.Sprintf("%s:%04o", path, c.Mode)
+}
+
+// create creates the path with its parent directories unless it exists.
+func (c CreatePath) create() error {
+	info, err := os.Stat(c.Path)
+	if err == nil {
+		if info.IsDir() != c.Dir {
+			kind := "a file"
+			if c.Dir {
+				kind = "a directory"
+			}
+			return fmt.Errorf("%s exists but is not %s", c.Path, kind)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return err
+	}
+	if c.Dir {
+		err = os.Mkdir(c.Path, c.Mode)
+	} else {
+		var f *os.File
+		f, err = os.OpenFile(c.Path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, c.Mode)
+		if err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Debug("Created %s with mode %04o", c.Path, c.Mode)
+	// Apply the exact mode regardless of the umask.
+	return os.Chmod(c.Path, c.Mode)
+}
+
+// stripOptional removes the optional marker from the paths of cfg and
+// returns the set of paths that are optional.
+func stripOptional(cfg Config) (Config, map[string]bool) {
+	optional := map[string]bool{}
+	required := map[string]bool{}
+	cfg.mapPaths(func(path string) (string, error) {
+		if strings.HasPrefix(path, OptionalPrefix) {
+			path = strings.TrimPrefix(path, OptionalPrefix)
+			optional[path] = true
+		} else {
+			required[path] = true
+		}
+		return path, nil
+	})
+	// A path is only optional if it is never requested without the marker.
+	for path := range required {
+		delete(optional, path)
+	}
+	return cfg, optional
+}
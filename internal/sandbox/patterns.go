@@ -0,0 +1,91 @@
+package sandbox
+
+import (
+	"fmt"
+
+	"github.com/zouuup/landrun/internal/glob"
+	"github.com/zouuup/landrun/internal/log"
+)
+
+// expandPatterns returns a copy of cfg with glob patterns in path lists
+// replaced by the paths they match. Matches inherit the sources recorded for
+// their pattern. Optional patterns may match nothing.
+func expandPatterns(cfg Config, optional map[string]bool) (Config, error) {
+	sources := cfg.Sources
+	cfg.Sources = nil
+	for key, s := range sources {
+		for _, source := range s {
+			cfg.AddSource(key, source)
+		}
+	}
+
+	// --rox and --rwx paths are also in the read-only and read-write lists,
+	// so remember expansions to match and log each pattern once.
+	expanded := map[string][]string{}
+	expand := func(pattern string) ([]string, error) {
+		if !glob.IsPattern(pattern) {
+			return []string{pattern}, nil
+		}
+		if matches, ok := expanded[pattern]; ok {
+			return matches, nil
+		}
+		matches, err := glob.Expand(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			if cfg.FailOnEmptyGlob && !optional[pattern] {
+				return nil, fmt.Errorf("pattern %q matches nothing", pattern)
+			}
+			log.Info("Pattern %s matches nothing, skipping", pattern)
+			expanded[pattern] = nil
+			return nil, nil
+		}
+		expanded[pattern] = matches
+		log.Debug("Pattern %s matches: %v", pattern, matches)
+		for _, m := range matches {
+			for _, source := range sources[pattern] {
+				cfg.AddSource(m, source)
+			}
+		}
+		return matches, nil
+	}
+	expandList := func(paths []string) ([]string, error) {
+		var out []string
+		for _, p := range paths {
+			matches, err := expand(p)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, matches...)
+		}
+		return out, nil
+	}
+
+	var err error
+	lists := []*[]string{
+		&cfg.ReadOnlyPaths,
+		&cfg.ReadWritePaths,
+		&cfg.ReadOnlyExecutablePaths,
+		&cfg.ReadWriteExecutablePaths,
+		&cfg.DenyPaths,
+	}
+	for _, l := range lists {
+		if *l, err = expandList(*l); err != nil {
+			return cfg, err
+		}
+	}
+
+	var custom []CustomPath
+	for _, cp := range cfg.CustomPaths {
+		matches, err := expand(cp.Path)
+		if err != nil {
+			return cfg, err
+		}
+		for _, m := range matches {
+			custom = append(custom, CustomPath{Path: m, Access: cp.Access})
+		}
+	}
+	cfg.CustomPaths = custom
+	return cfg, nil
+}
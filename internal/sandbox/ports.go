@@ -0,0 +1,126 @@
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zouuup/landrun/internal/log"
+)
+
+// servicesPath is the services database used to resolve port names.
+var servicesPath = "/etc/services"
+
+// maxPort is the highest TCP port number.
+const maxPort = 65535
+
+// ParsePorts parses a TCP port specification: a port number, an inclusive
+// range such as "8000-8099", or a service name from /etc/services such as
+// "https".
+func ParsePorts(spec string) ([]int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("empty port")
+	}
+	if lo, hi, ok := strings.Cut(spec, "-"); ok && isNumber(lo) && isNumber(hi) {
+		first, err := parsePort(lo)
+		if err != nil {
+			return nil, err
+		}
+		last, err := parsePort(hi)
+		if err != nil {
+			return nil, err
+		}
+		if first > last {
+			return nil, fmt.Errorf("invalid port range %q: start is greater than end", spec)
+		}
+		ports := make([]int, 0, last-first+1)
+		for p := first; p <= last; p++ {
+			ports = append(ports, p)
+		}
+		log.Debug("Port range %s expands to %d ports", spec, len(ports))
+		return ports, nil
+	}
+	if isNumber(spec) || strings.HasPrefix(spec, "-") {
+		port, err := parsePort(spec)
+		if err != nil {
+			return nil, err
+		}
+		return []int{port}, nil
+	}
+	port, err := lookupService(spec)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Service %s resolves to TCP port %d", spec, port)
+	return []int{port}, nil
+}
+
+// ValidatePort checks that port is a valid TCP port number.
+func ValidatePort(port int) error {
+	if port < 0 || port > maxPort {
+		return fmt.Errorf("port %d out of range (0-%d)", port, maxPort)
+	}
+	return nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	if err := ValidatePort(port); err != nil {
+		return 0, err
+	}
+	return port, nil
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupService resolves a TCP service name or alias from the services
+// database.
+func lookupService(name string) (int, error) {
+	f, err := os.Open(servicesPath)
+	if err != nil {
+		return 0, fmt.Errorf("cannot resolve service %q: %w", name, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		portProto := strings.SplitN(fields[1], "/", 2)
+		if len(portProto) != 2 || portProto[1] != "tcp" {
+			continue
+		}
+		names := append([]string{fields[0]}, fields[2:]...)
+		for _, n := range names {
+			if n == name {
+				return parsePort(portProto[0])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("cannot resolve service %q: %w", name, err)
+	}
+	return 0, fmt.Errorf("unknown TCP service %q", name)
+}
@@ -0,0 +1,176 @@
+package sandbox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/landlock-lsm/go-landlock/landlock"
+	"github.com/landlock-lsm/go-landlock/landlock/syscall"
+)
+
+// CustomPath grants an explicit set of access rights on a path, as given with
+// --path PATH:RIGHTS.
+type CustomPath struct {
+	Path   string
+	Access landlock.AccessFSSet
+}
+
+// abiVersion returns the Landlock ABI version of the running kernel, or 0
+// if Landlock is unavailable. It is a variable so tests can replace it.
+var abiVersion = func() int {
+	v, err := syscall.LandlockGetABIVersion()
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// ABIVersion returns the Landlock ABI version of the running kernel, or 0
+// if Landlock is unavailable.
+func ABIVersion() int {
+	return abiVersion()
+}
+
+// accessFSRights maps the Landlock filesystem access right names, without
+// the LANDLOCK_ACCESS_FS_ prefix, to their bits and the ABI version that
+// introduced them.
+var accessFSRights = []struct {
+	name   string
+	access landlock.AccessFSSet
+	abi    int
+}{
+	{"execute", syscall.AccessFSExecute, 1},
+	{"write_file", syscall.AccessFSWriteFile, 1},
+	{"read_file", syscall.AccessFSReadFile, 1},
+	{"read_dir", syscall.AccessFSReadDir, 1},
+	{"remove_dir", syscall.AccessFSRemoveDir, 1},
+	{"remove_file", syscall.AccessFSRemoveFile, 1},
+	{"make_char", syscall.AccessFSMakeChar, 1},
+	{"make_dir", syscall.AccessFSMakeDir, 1},
+	{"make_reg", syscall.AccessFSMakeReg, 1},
+	{"make_sock", syscall.AccessFSMakeSock, 1},
+	{"make_fifo", syscall.AccessFSMakeFifo, 1},
+	{"make_block", syscall.AccessFSMakeBlock, 1},
+	{"make_sym", syscall.AccessFSMakeSym, 1},
+	{"refer", syscall.AccessFSRefer, 2},
+	{"truncate", syscall.AccessFSTruncate, 3},
+	{"ioctl_dev", syscall.AccessFSIoctlDev, 5},
+}
+
+// accessFSAliases are shorthand names accepted in addition to the Landlock
+// right names. The class names match the --ro, --rox, --rw and --rwx flags.
+var accessFSAliases = map[string]landlock.AccessFSSet{
+	"read":  syscall.AccessFSReadFile | syscall.AccessFSReadDir,
+	"write": syscall.AccessFSWriteFile,
+	"exec":  syscall.AccessFSExecute,
+	"ro":    getReadOnlyRights(true),
+	"rox":   getReadOnlyExecutableRights(true),
+	"rw":    getReadWriteRights(true),
+	"rwx":   getReadWriteExecutableRights(true),
+}
+
+// fileAccessRights are the rights that apply to regular files. Landlock
+// rejects rules granting other rights on anything but a directory.
+const fileAccessRights = landlock.AccessFSSet(syscall.AccessFSExecute |
+	syscall.AccessFSWriteFile |
+	syscall.AccessFSReadFile |
+	syscall.AccessFSTruncate |
+	syscall.AccessFSIoctlDev)
+
+// ParseAccessFS parses a comma separated list of access right names or
+// aliases, e.g. "read,write,make_reg,truncate".
+func ParseAccessFS(spec string) (landlock.AccessFSSet, error) {
+	var access landlock.AccessFSSet
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if a, ok := accessFSAliases[name]; ok {
+			access |= a
+			continue
+		}
+		found := false
+		for _, r := range accessFSRights {
+			if r.name == name {
+				access |= r.access
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown access right %q (valid: %s)", name, strings.Join(accessRightNames(), ", "))
+		}
+	}
+	if access == 0 {
+		return 0, fmt.Errorf("no access rights given")
+	}
+	return access, nil
+}
+
+// ParseCustomPath parses a PATH:RIGHTS specification. The rights follow the
+// last colon so that paths may contain colons themselves.
+func ParseCustomPath(spec string) (CustomPath, error) {
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 {
+		return CustomPath{}, fmt.Errorf("invalid path rule %q, expected PATH:RIGHTS", spec)
+	}
+	access, err := ParseAccessFS(spec[i+1:])
+	if err != nil {
+		return CustomPath{}, fmt.Errorf("invalid path rule %q: %w", spec, err)
+	}
+	return CustomPath{Path: spec[:i], Access: access}, nil
+}
+
+// String formats the rule in the PATH:RIGHTS syntax accepted by
+// ParseCustomPath.
+func (c CustomPath) String() string {
+	return c.Path + ":" + strings.Join(AccessFSNames(c.Access), ",")
+}
+
+// AccessFSNames returns the Landlock names of the rights in access.
+func AccessFSNames(access landlock.AccessFSSet) []string {
+	var names []string
+	for _, r := range accessFSRights {
+		if access&r.access != 0 {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
+
+// supportedAccessFS returns the filesystem rights known to the given
+// Landlock ABI version.
+func supportedAccessFS(abi int) landlock.AccessFSSet {
+	var access landlock.AccessFSSet
+	for _, r := range accessFSRights {
+		if r.abi <= abi {
+			access |= r.access
+		}
+	}
+	return access
+}
+
+// minABI returns the lowest ABI version supporting all rights in access.
+func minABI(access landlock.AccessFSSet) int {
+	v := 0
+	for _, r := range accessFSRights {
+		if access&r.access != 0 && r.abi > v {
+			v = r.abi
+		}
+	}
+	return v
+}
+
+func accessRightNames() []string {
+	var names []string
+	for _, r := range accessFSRights {
+		names = append(names, r.name)
+	}
+	for alias := range accessFSAliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names
+}
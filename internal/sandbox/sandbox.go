@@ -2,23 +2,147 @@ package sandbox
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/landlock-lsm/go-landlock/landlock"
 	"github.com/landlock-lsm/go-landlock/landlock/syscall"
 	"github.com/zouuup/landrun/internal/log"
 )
 
+// TargetABI is the Landlock ABI version landrun configures. Without best-effort
+// mode, kernels providing an older version are rejected.
+const TargetABI = 5
+
 type Config struct {
 	ReadOnlyPaths            []string
 	ReadWritePaths           []string
 	ReadOnlyExecutablePaths  []string
 	ReadWriteExecutablePaths []string
+	CustomPaths              []CustomPath
+	DenyPaths                []string
+	CreatePaths              []CreatePath
 	BindTCPPorts             []int
 	ConnectTCPPorts          []int
 	BestEffort               bool
 	UnrestrictedFilesystem   bool
 	UnrestrictedNetwork      bool
+
+	// AllowSocketFamilies and DenySocketFamilies restrict the address
+	// families of the sockets the command can create, and NoUDP denies UDP
+	// sockets. See SocketFilter.
+	AllowSocketFamilies []string
+	DenySocketFamilies  []string
+	NoUDP               bool
+
+	// ScopeAbstractUnix and ScopeSignal block connecting to abstract unix
+	// sockets and sending signals outside the sandbox (Landlock ABI 6).
+	ScopeAbstractUnix bool
+	ScopeSignal       bool
+
+	// MissingPaths is the policy for paths that don't exist: MissingError
+	// (the default), MissingWarn or MissingSkip. Paths starting with
+	// OptionalPrefix are always skipped silently.
+	MissingPaths string
+
+	// FailOnEmptyGlob makes glob patterns in paths that match nothing an
+	// error instead of being skipped.
+	FailOnEmptyGlob bool
+
+	// Sources records which flags, profiles or presets requested each
+	// path or port, for reporting. Paths are keyed by the path itself and
+	// ports by "bind-tcp:PORT" or "connect-tcp:PORT".
+	Sources map[string][]string
+}
+
+// AddSource records that source requested the given path or port key.
+func (c *Config) AddSource(key, source string) {
+	if c.Sources == nil {
+		c.Sources = map[string][]string{}
+	}
+	c.Sources[key] = appendUnique(c.Sources[key], source)
+}
+
+// MapPaths replaces every path in the config with the result of fn, keeping
+// the recorded sources. The optional path marker is not passed to fn and is
+// kept in the result.
+func (c *Config) MapPaths(fn func(path string) (string, error)) error {
+	return c.mapPaths(func(path string) (string, error) {
+		if strings.HasPrefix(path, OptionalPrefix) {
+			m, err := fn(strings.TrimPrefix(path, OptionalPrefix))
+			return OptionalPrefix + m, err
+		}
+		return fn(path)
+	})
+}
+
+func (c *Config) mapPaths(fn func(path string) (string, error)) error {
+	sources := c.Sources
+	c.Sources = nil
+	mapped := map[string]string{}
+	mapPath := func(path string) (string, error) {
+		if m, ok := mapped[path]; ok {
+			return m, nil
+		}
+		m, err := fn(path)
+		if err != nil {
+			return "", err
+		}
+		mapped[path] = m
+		for _, source := range sources[path] {
+			c.AddSource(m, source)
+		}
+		return m, nil
+	}
+
+	lists := []*[]string{
+		&c.ReadOnlyPaths,
+		&c.ReadWritePaths,
+		&c.ReadOnlyExecutablePaths,
+		&c.ReadWriteExecutablePaths,
+		&c.DenyPaths,
+	}
+	for _, l := range lists {
+		out := make([]string, 0, len(*l))
+		for _, path := range *l {
+			m, err := mapPath(path)
+			if err != nil {
+				return err
+			}
+			out = append(out, m)
+		}
+		*l = out
+	}
+	custom := make([]CustomPath, 0, len(c.CustomPaths))
+	for _, cp := range c.CustomPaths {
+		m, err := mapPath(cp.Path)
+		if err != nil {
+			return err
+		}
+		custom = append(custom, CustomPath{Path: m, Access: cp.Access})
+	}
+	c.CustomPaths = custom
+	create := make([]CreatePath, 0, len(c.CreatePaths))
+	for _, cp := range c.CreatePaths {
+		m, err := mapPath(cp.Path)
+		if err != nil {
+			return err
+		}
+		cp.Path = m
+		create = append(create, cp)
+	}
+	c.CreatePaths = create
+
+	// Keep sources of keys that are not paths, such as ports.
+	for key, s := range sources {
+		if _, ok := mapped[key]; !ok {
+			for _, source := range s {
+				c.AddSource(key, source)
+			}
+		}
+	}
+	return nil
 }
 
 // getReadWriteExecutableRights returns a full set of permissions including execution
@@ -100,69 +224,361 @@ func isDirectory(path string) bool {
 	return fileInfo.IsDir()
 }
 
-func Apply(cfg Config) error {
-	log.Info("Sandbox config: %+v", cfg)
+// PathRule is a filesystem rule of a Ruleset. Rules from different flags on
+// the same path are merged, which is equivalent to installing them
+// separately since Landlock grants the union of all matching rules.
+type PathRule struct {
+	Path    string
+	Dir     bool
+	Access  landlock.AccessFSSet
+	Sources []string
 
-	// Get the most advanced Landlock version available
-	llCfg := landlock.V5
-	if cfg.BestEffort {
-		llCfg = llCfg.BestEffort()
+	// Create is set for paths that are created with Mode before the
+	// sandbox is enforced if they don't exist.
+	Create bool
+	Mode   os.FileMode
+}
+
+// PortRule is a TCP port rule of a Ruleset.
+type PortRule struct {
+	Port    int
+	Access  landlock.AccessNetSet
+	Sources []string
+}
+
+// Ruleset is the set of Landlock rules computed from a Config.
+type Ruleset struct {
+	Paths              []PathRule
+	Ports              []PortRule
+	RestrictFilesystem bool
+	RestrictNetwork    bool
+	ScopeAbstractUnix  bool
+	ScopeSignal        bool
+	BestEffort         bool
+
+	// Warnings describe limitations of the ruleset the user should know
+	// about, such as the side effects of --deny.
+	Warnings []string
+	// Downgrades describe the restrictions left out in best-effort mode
+	// because the kernel doesn't support them.
+	Downgrades []string
+}
+
+// Plan computes the rules landrun installs for cfg without enforcing them.
+// Glob patterns in paths are expanded first.
+func Plan(cfg Config) (*Ruleset, error) {
+	if err := ValidateMissingPolicy(cfg.MissingPaths); err != nil {
+		return nil, err
+	}
+	cfg, optional := stripOptional(cfg)
+	cfg, err := expandPatterns(cfg, optional)
+	if err != nil {
+		return nil, err
 	}
 
-	// Collect our rules
-	var file_rules []landlock.Rule
-	var net_rules []landlock.Rule
+	rs := &Ruleset{
+		RestrictFilesystem: !cfg.UnrestrictedFilesystem,
+		RestrictNetwork:    !cfg.UnrestrictedNetwork,
+		ScopeAbstractUnix:  cfg.ScopeAbstractUnix,
+		ScopeSignal:        cfg.ScopeSignal,
+		BestEffort:         cfg.BestEffort,
+	}
+	if cfg.UnrestrictedNetwork && cfg.restrictsSockets() {
+		rs.Warnings = append(rs.Warnings, "Socket family restrictions are ignored with unrestricted network access")
+	}
+	if rs.scopes() != 0 {
+		if abi := abiVersion(); abi < ScopeABI {
+			if !cfg.BestEffort {
+				return nil, fmt.Errorf("scoping %s requires Landlock ABI v%d, the kernel provides v%d", rs.scopeNames(), ScopeABI, abi)
+			}
+			rs.Warnings = append(rs.Warnings, fmt.Sprintf("Landlock ABI v%d does not support scoping; %s are not restricted", abi, rs.scopeNames()))
+			rs.Downgrades = append(rs.Downgrades, fmt.Sprintf("scoping %s (requires Landlock ABI v%d)", rs.scopeNames(), ScopeABI))
+			rs.ScopeAbstractUnix = false
+			rs.ScopeSignal = false
+		}
+	}
+	pathIndex := map[string]int{}
+	checked := map[string]bool{}
+	// usable applies the missing path policy and reports whether a rule
+	// should be added for path.
+	usable := func(path string) (bool, error) {
+		if ok, done := checked[path]; done {
+			return ok, nil
+		}
+		_, err := os.Stat(path)
+		checked[path] = err == nil
+		switch {
+		case err == nil:
+			return true, nil
+		case optional[path] || cfg.MissingPaths == MissingSkip:
+			log.Event(log.LevelDebug, "missing_path", log.Fields{Path: path, Err: err}, "Skipping missing path %s: %v", path, err)
+		case cfg.MissingPaths == MissingWarn:
+			rs.Warnings = append(rs.Warnings, fmt.Sprintf("Skipping missing path %s: %v", path, err))
+		default:
+			return false, fmt.Errorf("%w (prefix the path with %q or use --missing-paths=%s|%s to ignore it)", err, OptionalPrefix, MissingWarn, MissingSkip)
+		}
+		return false, nil
+	}
+	addPath := func(path string, rights func(dir bool) landlock.AccessFSSet) error {
+		i, ok := pathIndex[path]
+		if !ok {
+			if ok, err := usable(path); !ok {
+				return err
+			}
+			i = len(rs.Paths)
+			pathIndex[path] = i
+			rs.Paths = append(rs.Paths, PathRule{
+				Path:    path,
+				Dir:     isDirectory(path),
+				Sources: appendUnique(nil, cfg.Sources[path]...),
+			})
+		}
+		rs.Paths[i].Access |= rights(rs.Paths[i].Dir)
+		return nil
+	}
+	portIndex := map[int]int{}
+	addPort := func(port int, access landlock.AccessNetSet, source string) {
+		i, ok := portIndex[port]
+		if !ok {
+			i = len(rs.Ports)
+			portIndex[port] = i
+			rs.Ports = append(rs.Ports, PortRule{Port: port})
+		}
+		rs.Ports[i].Access |= access
+		rs.Ports[i].Sources = appendUnique(rs.Ports[i].Sources, cfg.Sources[source]...)
+	}
+
+	// Process paths created before the sandbox is enforced. Their type is
+	// known from the specification, and they don't need to exist yet.
+	for _, cp := range cfg.CreatePaths {
+		log.Debug("Adding path to create: %s", cp)
+		rights := getReadWriteRights
+		if cp.Exec {
+			rights = getReadWriteExecutableRights
+		}
+		i, ok := pathIndex[cp.Path]
+		if !ok {
+			i = len(rs.Paths)
+			pathIndex[cp.Path] = i
+			rs.Paths = append(rs.Paths, PathRule{
+				Path:    cp.Path,
+				Dir:     cp.Dir,
+				Create:  true,
+				Mode:    cp.Mode,
+				Sources: appendUnique(nil, cfg.Sources[cp.Path]...),
+			})
+		}
+		rs.Paths[i].Access |= rights(cp.Dir)
+	}
 
 	// Process executable paths
 	for _, path := range cfg.ReadOnlyExecutablePaths {
-		log.Debug("Adding read-only executable path: %s", path)
-		file_rules = append(file_rules, landlock.PathAccess(getReadOnlyExecutableRights(isDirectory(path)), path))
+		log.Event(log.LevelDebug, "add_path", log.Fields{Path: path, Rights: []string{"rox"}}, "Adding read-only executable path: %s", path)
+		if err := addPath(path, getReadOnlyExecutableRights); err != nil {
+			return nil, err
+		}
 	}
 
 	for _, path := range cfg.ReadWriteExecutablePaths {
-		log.Debug("Adding read-write executable path: %s", path)
-		file_rules = append(file_rules, landlock.PathAccess(getReadWriteExecutableRights(isDirectory(path)), path))
+		log.Event(log.LevelDebug, "add_path", log.Fields{Path: path, Rights: []string{"rwx"}}, "Adding read-write executable path: %s", path)
+		if err := addPath(path, getReadWriteExecutableRights); err != nil {
+			return nil, err
+		}
 	}
 
 	// Process read-only paths
 	for _, path := range cfg.ReadOnlyPaths {
-		log.Debug("Adding read-only path: %s", path)
-		file_rules = append(file_rules, landlock.PathAccess(getReadOnlyRights(isDirectory(path)), path))
+		log.Event(log.LevelDebug, "add_path", log.Fields{Path: path, Rights: []string{"ro"}}, "Adding read-only path: %s", path)
+		if err := addPath(path, getReadOnlyRights); err != nil {
+			return nil, err
+		}
 	}
 
 	// Process read-write paths
 	for _, path := range cfg.ReadWritePaths {
-		log.Debug("Adding read-write path: %s", path)
-		file_rules = append(file_rules, landlock.PathAccess(getReadWriteRights(isDirectory(path)), path))
+		log.Event(log.LevelDebug, "add_path", log.Fields{Path: path, Rights: []string{"rw"}}, "Adding read-write path: %s", path)
+		if err := addPath(path, getReadWriteRights); err != nil {
+			return nil, err
+		}
+	}
+
+	// Process paths with explicit rights
+	if len(cfg.CustomPaths) > 0 {
+		supported := supportedAccessFS(abiVersion())
+		for _, cp := range cfg.CustomPaths {
+			access := cp.Access
+			if missing := access &^ supported; missing != 0 {
+				if !cfg.BestEffort {
+					return nil, fmt.Errorf("path %s: %s requires Landlock ABI v%d, the kernel provides v%d",
+						cp.Path, strings.Join(AccessFSNames(missing), ", "), minABI(missing), abiVersion())
+				}
+				log.Info("Dropping %s on %s: not supported by this kernel", strings.Join(AccessFSNames(missing), ", "), cp.Path)
+				rs.Downgrades = append(rs.Downgrades, fmt.Sprintf("%s on %s (requires Landlock ABI v%d)", strings.Join(AccessFSNames(missing), ", "), cp.Path, minABI(missing)))
+				access &^= missing
+				if access == 0 {
+					continue
+				}
+			}
+			log.Event(log.LevelDebug, "add_path", log.Fields{Path: cp.Path, Rights: AccessFSNames(access)}, "Adding path %s with rights: %s", cp.Path, strings.Join(AccessFSNames(access), ", "))
+			err := addPath(cp.Path, func(dir bool) landlock.AccessFSSet {
+				if dir {
+					return access
+				}
+				if extra := access &^ fileAccessRights; extra != 0 {
+					log.Debug("Ignoring directory rights %s on non-directory %s", strings.Join(AccessFSNames(extra), ", "), cp.Path)
+				}
+				return access & fileAccessRights
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, port := range append(append([]int{}, cfg.BindTCPPorts...), cfg.ConnectTCPPorts...) {
+		if err := ValidatePort(port); err != nil {
+			return nil, err
+		}
 	}
 
 	// Add rules for TCP port binding
 	for _, port := range cfg.BindTCPPorts {
-		log.Debug("Adding TCP bind port: %d", port)
-		net_rules = append(net_rules, landlock.BindTCP(uint16(port)))
+		log.Event(log.LevelDebug, "add_port", log.Fields{Port: port, Rights: []string{"bind_tcp"}}, "Adding TCP bind port: %d", port)
+		addPort(port, syscall.AccessNetBindTCP, fmt.Sprintf("bind-tcp:%d", port))
 	}
 
 	// Add rules for TCP connections
 	for _, port := range cfg.ConnectTCPPorts {
-		log.Debug("Adding TCP connect port: %d", port)
-		net_rules = append(net_rules, landlock.ConnectTCP(uint16(port)))
+		log.Event(log.LevelDebug, "add_port", log.Fields{Port: port, Rights: []string{"connect_tcp"}}, "Adding TCP connect port: %d", port)
+		addPort(port, syscall.AccessNetConnectTCP, fmt.Sprintf("connect-tcp:%d", port))
+	}
+
+	// Carve denied trees out of the rules covering them
+	if len(cfg.DenyPaths) > 0 && cfg.UnrestrictedFilesystem {
+		return nil, fmt.Errorf("--deny cannot be combined with unrestricted filesystem access")
+	}
+	for _, path := range cfg.DenyPaths {
+		log.Event(log.LevelDebug, "deny_path", log.Fields{Path: path}, "Adding deny path: %s", path)
+		if err := applyDeny(rs, path); err != nil {
+			return nil, err
+		}
 	}
 
-	if cfg.UnrestrictedFilesystem && cfg.UnrestrictedNetwork {
-		log.Info("Unrestricted filesystem and network access enabled; no rules applied.")
+	// Rules granting only directory rights on a file grant nothing, and
+	// Landlock rejects empty rules.
+	paths := rs.Paths[:0]
+	for _, r := range rs.Paths {
+		if r.Access == 0 {
+			log.Debug("Skipping %s: no applicable rights", r.Path)
+			continue
+		}
+		paths = append(paths, r)
+	}
+	rs.Paths = paths
+
+	if rs.BestEffort {
+		rs.Downgrades = append(rs.Downgrades, rs.kernelDowngrades(abiVersion())...)
+	}
+	return rs, nil
+}
+
+// kernelDowngrades describes the restrictions of rs that Landlock ABI abi
+// doesn't support, which Enforce leaves out in best-effort mode.
+func (rs *Ruleset) kernelDowngrades(abi int) []string {
+	if !rs.RestrictFilesystem && !rs.RestrictNetwork {
 		return nil
 	}
+	if abi == 0 {
+		return []string{"all Landlock restrictions (Landlock is not available)"}
+	}
+	var downgrades []string
+	supported := supportedAccessFS(abi)
+	for _, r := range rs.Paths {
+		if missing := r.Access &^ supported; missing != 0 && rs.RestrictFilesystem {
+			downgrades = append(downgrades, fmt.Sprintf("%s on %s (requires Landlock ABI v%d)", strings.Join(AccessFSNames(missing), ", "), r.Path, minABI(missing)))
+		}
+	}
+	if rs.RestrictNetwork && abi < 4 {
+		downgrades = append(downgrades, "TCP bind and connect restrictions (requires Landlock ABI v4)")
+	}
+	return downgrades
+}
+
+// EnforcedABI returns the Landlock ABI version whose features Enforce uses
+// on the running kernel, or 0 if Landlock is unavailable.
+func (rs *Ruleset) EnforcedABI() int {
+	abi := abiVersion()
+	switch {
+	case rs.scopes() != 0 && abi >= ScopeABI:
+		return ScopeABI
+	case abi > TargetABI:
+		return TargetABI
+	}
+	return abi
+}
 
-	if cfg.UnrestrictedFilesystem {
+// Enforce restricts the current process to the rules in rs.
+func Enforce(rs *Ruleset) error {
+	for _, w := range rs.Warnings {
+		log.Warn("%s", w)
+	}
+
+	for _, r := range rs.Paths {
+		if !r.Create {
+			continue
+		}
+		cp := CreatePath{Path: r.Path, Dir: r.Dir, Mode: r.Mode}
+		if err := cp.create(); err != nil {
+			return fmt.Errorf("failed to create %s: %w", r.Path, err)
+		}
+	}
+
+	if scoped := rs.scopes(); scoped != 0 {
+		if err := restrictScopes(scoped); err != nil {
+			return fmt.Errorf("failed to apply Landlock scopes: %w", err)
+		}
+		log.Debug("Landlock scopes applied: %s", rs.scopeNames())
+	}
+
+	// Get the most advanced Landlock version available
+	llCfg := landlock.V5 // keep in sync with TargetABI
+	if rs.BestEffort {
+		llCfg = llCfg.BestEffort()
+	}
+
+	var file_rules []landlock.Rule
+	var net_rules []landlock.Rule
+	for _, r := range rs.Paths {
+		rights := AccessFSNames(r.Access)
+		log.Event(log.LevelTrace, "path_rule", log.Fields{Path: r.Path, Rights: rights}, "Rule for %s: %s", r.Path, strings.Join(rights, ", "))
+		file_rules = append(file_rules, landlock.PathAccess(r.Access, r.Path))
+	}
+	for _, r := range rs.Ports {
+		rights := strings.Split(strings.Trim(r.Access.String(), "{}"), ",")
+		log.Event(log.LevelTrace, "port_rule", log.Fields{Port: r.Port, Rights: rights}, "Rule for TCP port %d: %s", r.Port, strings.Join(rights, ", "))
+		if r.Access&syscall.AccessNetBindTCP != 0 {
+			net_rules = append(net_rules, landlock.BindTCP(uint16(r.Port)))
+		}
+		if r.Access&syscall.AccessNetConnectTCP != 0 {
+			net_rules = append(net_rules, landlock.ConnectTCP(uint16(r.Port)))
+		}
+	}
+
+	if !rs.RestrictFilesystem && !rs.RestrictNetwork {
+		log.Info("Unrestricted filesystem and network access enabled; no filesystem or network rules applied.")
+		return nil
+	}
+
+	if !rs.RestrictFilesystem {
 		log.Info("Unrestricted filesystem access enabled.")
 	}
 
-	if cfg.UnrestrictedNetwork {
+	if !rs.RestrictNetwork {
 		log.Info("Unrestricted network access enabled")
 	}
 
 	// If we have no rules, just return
-	if len(file_rules) == 0 && len(net_rules) == 0 && !cfg.UnrestrictedFilesystem && !cfg.UnrestrictedNetwork {
+	if len(file_rules) == 0 && len(net_rules) == 0 && rs.RestrictFilesystem && rs.RestrictNetwork {
 		log.Error("No rules provided, applying default restrictive rules, this will restrict anything landlock can do.")
 		err := llCfg.Restrict()
 		if err != nil {
@@ -174,13 +590,13 @@ func Apply(cfg Config) error {
 
 	// Apply all rules at once
 	log.Debug("Applying Landlock restrictions")
-	if !cfg.UnrestrictedFilesystem {
+	if rs.RestrictFilesystem {
 		err := llCfg.RestrictPaths(file_rules...)
 		if err != nil {
 			return fmt.Errorf("failed to apply Landlock filesystem restrictions: %w", err)
 		}
 	}
-	if !cfg.UnrestrictedNetwork {
+	if rs.RestrictNetwork {
 		err := llCfg.RestrictNet(net_rules...)
 		if err != nil {
 			return fmt.Errorf("failed to apply Landlock network restrictions: %w", err)
@@ -190,3 +606,102 @@ func Apply(cfg Config) error {
 	log.Info("Landlock restrictions applied successfully")
 	return nil
 }
+
+// Apply computes the rules for cfg and enforces them on the current process.
+func Apply(cfg Config) error {
+	log.Info("Sandbox config: %+v", cfg)
+
+	rs, err := Plan(cfg)
+	if err != nil {
+		return err
+	}
+	return Enforce(rs)
+}
+
+// WriteText writes a human readable description of the ruleset.
+func (rs *Ruleset) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Filesystem:")
+	switch {
+	case !rs.RestrictFilesystem:
+		fmt.Fprintln(w, "  unrestricted")
+	case len(rs.Paths) == 0:
+		fmt.Fprintln(w, "  no access")
+	}
+	if rs.RestrictFilesystem {
+		for _, r := range rs.Paths {
+			kind := "file"
+			if r.Dir {
+				kind = "dir"
+			}
+			if r.Create {
+				kind += fmt.Sprintf(", created with mode %04o if missing", r.Mode)
+			}
+			fmt.Fprintf(w, "  %s (%s)\n", r.Path, kind)
+			fmt.Fprintf(w, "    access: %s\n", accessNames(r.Access.String()))
+			if len(r.Sources) > 0 {
+				fmt.Fprintf(w, "    from:   %s\n", strings.Join(r.Sources, ", "))
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "Network:")
+	switch {
+	case !rs.RestrictNetwork:
+		fmt.Fprintln(w, "  unrestricted")
+	case len(rs.Ports) == 0:
+		fmt.Fprintln(w, "  no TCP bind or connect")
+	}
+	if rs.RestrictNetwork {
+		for _, r := range rs.Ports {
+			fmt.Fprintf(w, "  tcp/%d\n", r.Port)
+			fmt.Fprintf(w, "    access: %s\n", accessNames(r.Access.String()))
+			if len(r.Sources) > 0 {
+				fmt.Fprintf(w, "    from:   %s\n", strings.Join(r.Sources, ", "))
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "Scopes:")
+	if names := rs.scopeNames(); names != "" {
+		fmt.Fprintf(w, "  %s\n", names)
+	} else {
+		fmt.Fprintln(w, "  none")
+	}
+
+	fmt.Fprintf(w, "Best effort: %t\n", rs.BestEffort)
+	if len(rs.Downgrades) > 0 {
+		fmt.Fprintln(w, "Not enforced by this kernel:")
+		for _, d := range rs.Downgrades {
+			fmt.Fprintf(w, "  %s\n", d)
+		}
+	}
+
+	if len(rs.Warnings) > 0 {
+		fmt.Fprintln(w, "Warnings:")
+		for _, warning := range rs.Warnings {
+			fmt.Fprintf(w, "  %s\n", warning)
+		}
+	}
+}
+
+// accessNames turns go-landlock's "{a,b}" set notation into "a, b".
+func accessNames(set string) string {
+	return strings.ReplaceAll(strings.Trim(set, "{}"), ",", ", ")
+}
+
+// appendUnique appends the values of add that are not already in list.
+func appendUnique(list []string, add ...string) []string {
+	for _, a := range add {
+		found := false
+		for _, l := range list {
+			if l == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, a)
+		}
+	}
+	return list
+}
@@ -0,0 +1,443 @@
+package sandbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/landlock-lsm/go-landlock/landlock"
+	"github.com/landlock-lsm/go-landlock/landlock/syscall"
+)
+
+func TestPlanMergesRulesPerPath(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		ReadOnlyPaths:           []string{dir},
+		ReadOnlyExecutablePaths: []string{dir},
+		ConnectTCPPorts:         []int{443},
+		BindTCPPorts:            []int{443, 8080},
+	}
+	cfg.AddSource(dir, "--ro")
+	cfg.AddSource(dir, "--rox")
+	cfg.AddSource("connect-tcp:443", "--connect-tcp")
+
+	rs, err := Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(rs.Paths) != 1 {
+		t.Fatalf("expected a single merged path rule, got %+v", rs.Paths)
+	}
+	r := rs.Paths[0]
+	if !r.Dir || r.Access != getReadOnlyExecutableRights(true) {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if !reflect.DeepEqual(r.Sources, []string{"--ro", "--rox"}) {
+		t.Errorf("sources = %v", r.Sources)
+	}
+
+	if len(rs.Ports) != 2 {
+		t.Fatalf("expected two port rules, got %+v", rs.Ports)
+	}
+	want := landlock.AccessNetSet(syscall.AccessNetBindTCP | syscall.AccessNetConnectTCP)
+	if rs.Ports[0].Port != 443 || rs.Ports[0].Access != want {
+		t.Errorf("unexpected port rule %+v", rs.Ports[0])
+	}
+	if !rs.RestrictFilesystem || !rs.RestrictNetwork {
+		t.Errorf("expected filesystem and network to be restricted")
+	}
+}
+
+func TestPlanFileRights(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{ReadWritePaths: []string{file}}
+	rs, err := Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if rs.Paths[0].Dir {
+		t.Errorf("file should not be treated as a directory")
+	}
+	if rs.Paths[0].Access&landlock.AccessFSSet(syscall.AccessFSMakeReg) != 0 {
+		t.Errorf("file rule must not contain directory rights: %v", rs.Paths[0].Access)
+	}
+}
+
+func TestRulesetWriteText(t *testing.T) {
+	rs, err := Plan(Config{
+		ReadOnlyPaths:       []string{"/"},
+		UnrestrictedNetwork: true,
+		Sources:             map[string][]string{"/": {"--ro"}},
+	})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	var out bytes.Buffer
+	rs.WriteText(&out)
+	for _, want := range []string{"/ (dir)", "access: read_file, read_dir", "from:   --ro", "Network:\n  unrestricted"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestParseCustomPath(t *testing.T) {
+	cp, err := ParseCustomPath("/var/spool/x:read,write,make_reg,truncate")
+	if err != nil {
+		t.Fatalf("ParseCustomPath failed: %v", err)
+	}
+	want := landlock.AccessFSSet(syscall.AccessFSReadFile | syscall.AccessFSReadDir |
+		syscall.AccessFSWriteFile | syscall.AccessFSMakeReg | syscall.AccessFSTruncate)
+	if cp.Path != "/var/spool/x" || cp.Access != want {
+		t.Errorf("unexpected rule %+v", cp)
+	}
+	if got := cp.String(); got != "/var/spool/x:write_file,read_file,read_dir,make_reg,truncate" {
+		t.Errorf("String() = %q", got)
+	}
+
+	cp, err = ParseCustomPath("/a:b:rox")
+	if err != nil || cp.Path != "/a:b" || cp.Access != getReadOnlyExecutableRights(true) {
+		t.Errorf("unexpected rule %+v, %v", cp, err)
+	}
+
+	for _, spec := range []string{"/usr", "/usr:", ":execute", "/usr:read,delete"} {
+		if _, err := ParseCustomPath(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestPlanCustomPathABI(t *testing.T) {
+	defer func(f func() int) { abiVersion = f }(abiVersion)
+	abiVersion = func() int { return 2 }
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{CustomPaths: []CustomPath{
+		{Path: dir, Access: landlock.AccessFSSet(syscall.AccessFSMakeReg | syscall.AccessFSTruncate)},
+		{Path: file, Access: landlock.AccessFSSet(syscall.AccessFSMakeDir)},
+	}}
+	if _, err := Plan(cfg); err == nil || !strings.Contains(err.Error(), "truncate requires Landlock ABI v3") {
+		t.Fatalf("expected an ABI error, got %v", err)
+	}
+
+	cfg.BestEffort = true
+	rs, err := Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(rs.Paths) != 1 || rs.Paths[0].Access != landlock.AccessFSSet(syscall.AccessFSMakeReg) {
+		t.Errorf("expected unsupported and directory-only rights to be dropped, got %+v", rs.Paths)
+	}
+	if len(rs.Downgrades) == 0 || rs.Downgrades[0] != "truncate on "+dir+" (requires Landlock ABI v3)" {
+		t.Errorf("unexpected downgrades %q", rs.Downgrades)
+	}
+}
+
+func TestPlanDowngrades(t *testing.T) {
+	defer func(f func() int) { abiVersion = f }(abiVersion)
+	abiVersion = func() int { return 2 }
+
+	dir := t.TempDir()
+	cfg := Config{ReadOnlyPaths: []string{dir}, ReadWritePaths: []string{dir}, ConnectTCPPorts: []int{443}, BestEffort: true}
+	rs, err := Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	want := []string{
+		"truncate, ioctl_dev on " + dir + " (requires Landlock ABI v5)",
+		"TCP bind and connect restrictions (requires Landlock ABI v4)",
+	}
+	if !reflect.DeepEqual(rs.Downgrades, want) {
+		t.Errorf("downgrades = %q, want %q", rs.Downgrades, want)
+	}
+	if abi := rs.EnforcedABI(); abi != 2 {
+		t.Errorf("EnforcedABI() = %d, want 2", abi)
+	}
+
+	cfg.BestEffort = false
+	if rs, err := Plan(cfg); err != nil || len(rs.Downgrades) != 0 {
+		t.Errorf("expected no downgrades without best-effort mode, got %q, %v", rs.Downgrades, err)
+	}
+}
+
+func TestPlanDeny(t *testing.T) {
+	home := t.TempDir()
+	for _, d := range []string{".ssh", ".config/gcloud", ".config/app", "docs"} {
+		if err := os.MkdirAll(filepath.Join(home, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(home, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(".ssh", filepath.Join(home, "keys")); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := Plan(Config{
+		ReadWritePaths: []string{home},
+		DenyPaths:      []string{filepath.Join(home, ".ssh"), filepath.Join(home, ".config/gcloud")},
+	})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	got := map[string]PathRule{}
+	for _, r := range rs.Paths {
+		got[r.Path] = r
+	}
+	for _, want := range []string{"docs", "notes.txt", ".config/app"} {
+		if _, ok := got[filepath.Join(home, want)]; !ok {
+			t.Errorf("expected a rule for %s, got %+v", want, rs.Paths)
+		}
+	}
+	for _, unwanted := range []string{"", ".ssh", "keys", ".config", ".config/gcloud"} {
+		if _, ok := got[filepath.Join(home, unwanted)]; ok {
+			t.Errorf("unexpected rule for %q", unwanted)
+		}
+	}
+	if r := got[filepath.Join(home, "notes.txt")]; r.Dir || r.Access != getReadWriteRights(false) {
+		t.Errorf("file entry should get file rights only: %+v", r)
+	}
+	if len(rs.Warnings) != 3 {
+		t.Errorf("expected warnings for both splits and the symlink, got %q", rs.Warnings)
+	}
+
+	if _, err := Plan(Config{DenyPaths: []string{home}, UnrestrictedFilesystem: true}); err == nil {
+		t.Errorf("expected --deny with unrestricted filesystem to fail")
+	}
+}
+
+func TestPlanExpandsPatterns(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.pem", "b.pem", "c.key"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pattern := filepath.Join(dir, "*.pem")
+	cfg := Config{ReadOnlyPaths: []string{pattern, filepath.Join(dir, "*.crt")}}
+	cfg.AddSource(pattern, "--ro")
+
+	rs, err := Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(rs.Paths) != 2 || rs.Paths[0].Path != filepath.Join(dir, "a.pem") || rs.Paths[1].Path != filepath.Join(dir, "b.pem") {
+		t.Fatalf("unexpected rules %+v", rs.Paths)
+	}
+	if !reflect.DeepEqual(rs.Paths[0].Sources, []string{"--ro"}) {
+		t.Errorf("matches should inherit the pattern's sources, got %v", rs.Paths[0].Sources)
+	}
+
+	cfg.FailOnEmptyGlob = true
+	if _, err := Plan(cfg); err == nil || !strings.Contains(err.Error(), "matches nothing") {
+		t.Errorf("expected an error for the empty pattern, got %v", err)
+	}
+}
+
+func TestConfigMapPaths(t *testing.T) {
+	cfg := Config{
+		ReadOnlyPaths: []string{"~/a"},
+		CustomPaths:   []CustomPath{{Path: "~/b", Access: getReadOnlyRights(false)}},
+		BindTCPPorts:  []int{80},
+	}
+	cfg.AddSource("~/a", "--ro")
+	cfg.AddSource("bind-tcp:80", "--bind-tcp")
+
+	err := cfg.MapPaths(func(path string) (string, error) {
+		return strings.Replace(path, "~", "/home/u", 1), nil
+	})
+	if err != nil {
+		t.Fatalf("MapPaths failed: %v", err)
+	}
+	if cfg.ReadOnlyPaths[0] != "/home/u/a" || cfg.CustomPaths[0].Path != "/home/u/b" {
+		t.Errorf("paths not mapped: %+v", cfg)
+	}
+	want := map[string][]string{"/home/u/a": {"--ro"}, "bind-tcp:80": {"--bind-tcp"}}
+	if !reflect.DeepEqual(cfg.Sources, want) {
+		t.Errorf("sources = %v, want %v", cfg.Sources, want)
+	}
+}
+
+func TestPlanScopes(t *testing.T) {
+	defer func(f func() int) { abiVersion = f }(abiVersion)
+	abiVersion = func() int { return 5 }
+
+	cfg := Config{ScopeAbstractUnix: true, ScopeSignal: true, UnrestrictedFilesystem: true, UnrestrictedNetwork: true}
+	if _, err := Plan(cfg); err == nil || !strings.Contains(err.Error(), "requires Landlock ABI v6") {
+		t.Fatalf("expected an ABI error, got %v", err)
+	}
+
+	cfg.BestEffort = true
+	rs, err := Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if rs.scopes() != 0 || len(rs.Warnings) != 1 {
+		t.Errorf("expected scopes to be dropped with a warning, got %+v", rs)
+	}
+
+	abiVersion = func() int { return 6 }
+	rs, err = Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if rs.scopes() != scopeAbstractUnixSocket|scopeSignal {
+		t.Errorf("unexpected scopes %#x", rs.scopes())
+	}
+	var out bytes.Buffer
+	rs.WriteText(&out)
+	if !strings.Contains(out.String(), "Scopes:\n  abstract unix sockets, signals") {
+		t.Errorf("scopes missing from output:\n%s", out.String())
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	services := filepath.Join(t.TempDir(), "services")
+	data := "# comment\nhttps\t\t443/tcp\t\t\t# http protocol over TLS/SSL\nhttps\t\t443/udp\npostgresql\t5432/tcp\tpostgres\nsyslog\t\t514/udp\n"
+	if err := os.WriteFile(services, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { servicesPath = p }(servicesPath)
+	servicesPath = services
+
+	cases := map[string][]int{
+		"443":       {443},
+		"0":         {0},
+		"65535":     {65535},
+		"8000-8003": {8000, 8001, 8002, 8003},
+		"https":     {443},
+		"postgres":  {5432},
+	}
+	for spec, want := range cases {
+		got, err := ParsePorts(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", spec, got, want)
+		}
+	}
+
+	for _, spec := range []string{"70000", "-1", "9-3", "1-70000", "syslog", "nosuch", ""} {
+		if _, err := ParsePorts(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+
+	if _, err := Plan(Config{ConnectTCPPorts: []int{70000}}); err == nil {
+		t.Errorf("expected Plan to reject an out of range port")
+	}
+}
+
+func TestPlanMissingPaths(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+
+	if _, err := Plan(Config{ReadOnlyPaths: []string{dir, missing}}); err == nil || !strings.Contains(err.Error(), "--missing-paths") {
+		t.Fatalf("expected a missing path error, got %v", err)
+	}
+
+	rs, err := Plan(Config{ReadOnlyPaths: []string{dir, missing}, MissingPaths: MissingWarn})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(rs.Paths) != 1 || len(rs.Warnings) != 1 {
+		t.Errorf("expected the missing path to be skipped with a warning, got %+v", rs)
+	}
+
+	rs, err = Plan(Config{ReadOnlyPaths: []string{dir, "?" + missing, "?" + filepath.Join(dir, "*.conf")}, FailOnEmptyGlob: true})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(rs.Paths) != 1 || len(rs.Warnings) != 0 {
+		t.Errorf("expected optional paths to be skipped silently, got %+v", rs)
+	}
+
+	if _, err := Plan(Config{ReadOnlyPaths: []string{"?" + missing, missing}}); err == nil {
+		t.Errorf("a path required elsewhere must not become optional")
+	}
+	if _, err := Plan(Config{MissingPaths: "ignore"}); err == nil {
+		t.Errorf("expected an invalid policy error")
+	}
+}
+
+func TestCreatePath(t *testing.T) {
+	dir := t.TempDir()
+	for spec, want := range map[string]CreatePath{
+		"/var/lib/app/":     {Path: "/var/lib/app", Dir: true, Mode: 0755},
+		"/var/lib/app/:750": {Path: "/var/lib/app", Dir: true, Mode: 0750},
+		"/run/app.pid":      {Path: "/run/app.pid", Mode: 0644},
+		"/a:b/c:0600":       {Path: "/a:b/c", Mode: 0600},
+	} {
+		got, err := ParseCreatePath(spec, false)
+		if err != nil || got != want {
+			t.Errorf("%s: got %+v, %v, want %+v", spec, got, err, want)
+		}
+	}
+	if _, err := ParseCreatePath("/x:rw", false); err == nil {
+		t.Errorf("expected an invalid mode error")
+	}
+
+	state := filepath.Join(dir, "state", "app")
+	logFile := filepath.Join(dir, "log", "app.log")
+	rs, err := Plan(Config{CreatePaths: []CreatePath{
+		{Path: state, Dir: true, Mode: 0700},
+		{Path: logFile, Mode: 0600},
+	}})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(rs.Paths) != 2 || !rs.Paths[0].Create || !rs.Paths[0].Dir || rs.Paths[1].Dir {
+		t.Fatalf("unexpected rules %+v", rs.Paths)
+	}
+	if _, err := os.Stat(state); !os.IsNotExist(err) {
+		t.Fatalf("Plan must not create paths")
+	}
+
+	for _, r := range rs.Paths {
+		cp := CreatePath{Path: r.Path, Dir: r.Dir, Mode: r.Mode}
+		if err := cp.create(); err != nil {
+			t.Fatalf("create %s: %v", r.Path, err)
+		}
+	}
+	if info, err := os.Stat(state); err != nil || !info.IsDir() || info.Mode().Perm() != 0700 {
+		t.Errorf("state directory not created as expected: %v %v", info, err)
+	}
+	if info, err := os.Stat(logFile); err != nil || info.IsDir() || info.Mode().Perm() != 0600 {
+		t.Errorf("log file not created as expected: %v %v", info, err)
+	}
+	if err := (CreatePath{Path: logFile, Dir: true}).create(); err == nil {
+		t.Errorf("expected an error when a file exists where a directory is wanted")
+	}
+}
+
+func TestSocketFilter(t *testing.T) {
+	cfg := Config{DenySocketFamilies: []string{"packet"}, NoUDP: true, UnrestrictedFilesystem: true}
+	if f := cfg.SocketFilter(); !f.NoUDP || len(f.Deny) != 1 {
+		t.Errorf("unexpected socket filter %+v", f)
+	}
+
+	cfg.UnrestrictedNetwork = true
+	if f := cfg.SocketFilter(); f.Enabled() {
+		t.Errorf("expected no socket filter with unrestricted network, got %+v", f)
+	}
+	rs, err := Plan(cfg)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(rs.Warnings) != 1 || !strings.Contains(rs.Warnings[0], "Socket family restrictions are ignored") {
+		t.Errorf("expected a warning about ignored socket restrictions, got %q", rs.Warnings)
+	}
+}
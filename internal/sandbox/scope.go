@@ -0,0 +1,75 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"golang.org/x/sys/unix"
+)
+
+// ScopeABI is the Landlock ABI version that introduced scoping.
+const ScopeABI = 6
+
+// Landlock scope flags (LANDLOCK_SCOPE_*). go-landlock does not support
+// scoping yet, so the scoped ruleset is created directly.
+const (
+	scopeAbstractUnixSocket = 1 << 0
+	scopeSignal             = 1 << 1
+)
+
+// scopedRulesetAttr is struct landlock_ruleset_attr as of ABI 6.
+type scopedRulesetAttr struct {
+	HandledAccessFS  uint64
+	HandledAccessNet uint64
+	Scoped           uint64
+}
+
+// scopes returns the LANDLOCK_SCOPE_* flags requested by rs.
+func (rs *Ruleset) scopes() uint64 {
+	var scoped uint64
+	if rs.ScopeAbstractUnix {
+		scoped |= scopeAbstractUnixSocket
+	}
+	if rs.ScopeSignal {
+		scoped |= scopeSignal
+	}
+	return scoped
+}
+
+// scopeNames describes the scopes of rs for reporting.
+func (rs *Ruleset) scopeNames() string {
+	var names []string
+	if rs.ScopeAbstractUnix {
+		names = append(names, "abstract unix sockets")
+	}
+	if rs.ScopeSignal {
+		names = append(names, "signals")
+	}
+	return strings.Join(names, ", ")
+}
+
+// restrictScopes enforces the given scopes on all threads of the process in
+// a Landlock domain of its own, which stacks with the filesystem and network
+// domains.
+func restrictScopes(scoped uint64) error {
+	attr := scopedRulesetAttr{Scoped: scoped}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		if errors.Is(errno, unix.EINVAL) || errors.Is(errno, unix.E2BIG) {
+			return fmt.Errorf("landlock_create_ruleset: scoping is not supported by this kernel: %w", errno)
+		}
+		return fmt.Errorf("landlock_create_ruleset: %w", errno)
+	}
+	defer unix.Close(int(fd))
+
+	if err := ll.AllThreadsPrctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %w", err)
+	}
+	if err := ll.AllThreadsLandlockRestrictSelf(int(fd), 0); err != nil {
+		return fmt.Errorf("landlock_restrict_self: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package sandbox
+
+import "github.com/zouuup/landrun/internal/seccomp"
+
+// SocketFilter returns the socket restrictions of cfg, which landrun enforces
+// with seccomp since Landlock only controls TCP bind and connect. Like the
+// TCP port rules, they are lifted by UnrestrictedNetwork.
+func (c Config) SocketFilter() seccomp.SocketFilter {
+	if c.UnrestrictedNetwork {
+		return seccomp.SocketFilter{}
+	}
+	return seccomp.SocketFilter{
+		Allow: append([]string{}, c.AllowSocketFamilies...),
+		Deny:  append([]string{}, c.DenySocketFamilies...),
+		NoUDP: c.NoUDP,
+	}
+}
+
+// restrictsSockets reports whether cfg asks for socket restrictions.
+func (c Config) restrictsSockets() bool {
+	return len(c.AllowSocketFamilies) > 0 || len(c.DenySocketFamilies) > 0 || c.NoUDP
+}
@@ -0,0 +1,448 @@
+package seccomp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zouuup/landrun/internal/log"
+	"golang.org/x/sys/unix"
+)
+
+// OCIProfile is a seccomp profile in the JSON format of Docker and the OCI
+// runtime specification.
+type OCIProfile struct {
+	DefaultAction   string       `json:"defaultAction"`
+	DefaultErrnoRet *uint        `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string     `json:"architectures,omitempty"`
+	ArchMap         []OCIArchMap `json:"archMap,omitempty"`
+	Syscalls        []OCISyscall `json:"syscalls,omitempty"`
+}
+
+// OCIArchMap lists an architecture with the sub-architectures the profile
+// also applies to.
+type OCIArchMap struct {
+	Architecture     string   `json:"architecture"`
+	SubArchitectures []string `json:"subArchitectures,omitempty"`
+}
+
+// OCISyscall is a rule for one or more syscalls. Name is the older,
+// single-syscall form of Names.
+type OCISyscall struct {
+	Name     string    `json:"name,omitempty"`
+	Names    []string  `json:"names,omitempty"`
+	Action   string    `json:"action"`
+	ErrnoRet *uint     `json:"errnoRet,omitempty"`
+	Args     []OCIArg  `json:"args,omitempty"`
+	Includes OCIFilter `json:"includes,omitempty"`
+	Excludes OCIFilter `json:"excludes,omitempty"`
+}
+
+// OCIArg is a comparison of a syscall argument. For SCMP_CMP_MASKED_EQ,
+// Value is the mask and ValueTwo the expected result.
+type OCIArg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo,omitempty"`
+	Op       string `json:"op"`
+}
+
+// OCIFilter restricts a rule to some architectures, capabilities or kernel
+// versions.
+type OCIFilter struct {
+	Arches    []string `json:"arches,omitempty"`
+	Caps      []string `json:"caps,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+// offsetArgs is the offset of the args array of struct seccomp_data. Each
+// argument is 64 bits wide, low word first on the supported architectures.
+const offsetArgs = 16
+
+// ociOps are the argument comparison operators of OCI profiles.
+var ociOps = map[string]bool{
+	"SCMP_CMP_NE": true, "SCMP_CMP_LT": true, "SCMP_CMP_LE": true, "SCMP_CMP_EQ": true,
+	"SCMP_CMP_GE": true, "SCMP_CMP_GT": true, "SCMP_CMP_MASKED_EQ": true,
+}
+
+// capNames are the capability names by number.
+var capNames = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER", "CAP_FSETID",
+	"CAP_KILL", "CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP", "CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST", "CAP_NET_ADMIN", "CAP_NET_RAW", "CAP_IPC_LOCK",
+	"CAP_IPC_OWNER", "CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT", "CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE", "CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD", "CAP_LEASE", "CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL", "CAP_SETFCAP", "CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG",
+	"CAP_WAKE_ALARM", "CAP_BLOCK_SUSPEND", "CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// LoadOCIProfile reads and validates a Docker/OCI seccomp profile.
+func LoadOCIProfile(path string) (*OCIProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p OCIProfile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Validate checks the actions and comparisons of the profile, and that it
+// applies to this architecture.
+func (p *OCIProfile) Validate() error {
+	if !Supported() {
+		return fmt.Errorf("seccomp filters are not supported on this architecture")
+	}
+	if p.DefaultAction == "" {
+		return fmt.Errorf("missing defaultAction")
+	}
+	if _, err := ociAction(p.DefaultAction, p.DefaultErrnoRet); err != nil {
+		return fmt.Errorf("defaultAction: %w", err)
+	}
+	if !p.coversArch() {
+		return fmt.Errorf("profile does not apply to %s (architectures: %s)", scmpArch, strings.Join(p.Architectures, ", "))
+	}
+	for i, rule := range p.Syscalls {
+		if rule.Name == "" && len(rule.Names) == 0 {
+			return fmt.Errorf("syscalls[%d]: no syscall names", i)
+		}
+		if _, err := ociAction(rule.Action, rule.ErrnoRet); err != nil {
+			return fmt.Errorf("syscalls[%d]: %w", i, err)
+		}
+		for j, arg := range rule.Args {
+			if arg.Index > 5 {
+				return fmt.Errorf("syscalls[%d].args[%d]: argument index %d out of range", i, j, arg.Index)
+			}
+			if !ociOps[arg.Op] {
+				return fmt.Errorf("syscalls[%d].args[%d]: unsupported operator %q", i, j, arg.Op)
+			}
+		}
+	}
+	return nil
+}
+
+// coversArch reports whether the native architecture is listed by the
+// profile, directly or through archMap. A profile without architectures
+// applies to all of them.
+func (p *OCIProfile) coversArch() bool {
+	if len(p.Architectures) == 0 && len(p.ArchMap) == 0 {
+		return true
+	}
+	if contains(p.Architectures, scmpArch) {
+		return true
+	}
+	for _, m := range p.ArchMap {
+		if m.Architecture == scmpArch || contains(m.SubArchitectures, scmpArch) {
+			return true
+		}
+	}
+	return false
+}
+
+// ociAction converts an SCMP_ACT_* action into a seccomp return value.
+func ociAction(action string, errnoRet *uint) (uint32, error) {
+	data := func(def uint) uint32 {
+		if errnoRet != nil {
+			return uint32(*errnoRet) & unix.SECCOMP_RET_DATA
+		}
+		return uint32(def)
+	}
+	switch action {
+	case "SCMP_ACT_ALLOW":
+		return unix.SECCOMP_RET_ALLOW, nil
+	case "SCMP_ACT_ERRNO":
+		return unix.SECCOMP_RET_ERRNO | data(uint(unix.EPERM)), nil
+	case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+		return unix.SECCOMP_RET_KILL_THREAD, nil
+	case "SCMP_ACT_KILL_PROCESS":
+		return unix.SECCOMP_RET_KILL_PROCESS, nil
+	case "SCMP_ACT_TRAP":
+		return unix.SECCOMP_RET_TRAP, nil
+	case "SCMP_ACT_TRACE":
+		return unix.SECCOMP_RET_TRACE | data(0), nil
+	case "SCMP_ACT_LOG":
+		return unix.SECCOMP_RET_LOG, nil
+	}
+	return 0, fmt.Errorf("unsupported action %q", action)
+}
+
+// ociRule is a rule of the profile that applies on this host, for a single
+// syscall.
+type ociRule struct {
+	ret  uint32
+	args []OCIArg
+}
+
+// rules returns the applicable rules of the profile by syscall number, in
+// the order of the profile, and the syscalls in the order they first appear.
+func (p *OCIProfile) rules() (map[uint32][]ociRule, []uint32) {
+	caps := effectiveCaps()
+	kernel := kernelVersion()
+	byNr := map[uint32][]ociRule{}
+	var order []uint32
+	var unknown []string
+	for _, rule := range p.Syscalls {
+		if !rule.applies(caps, kernel) {
+			continue
+		}
+		ret, _ := ociAction(rule.Action, rule.ErrnoRet)
+		names := rule.Names
+		if rule.Name != "" {
+			names = append([]string{rule.Name}, names...)
+		}
+		for _, name := range names {
+			nr, ok := syscallNumbers[name]
+			if !ok {
+				unknown = append(unknown, name)
+				continue
+			}
+			if _, seen := byNr[nr]; !seen {
+				order = append(order, nr)
+			}
+			byNr[nr] = append(byNr[nr], ociRule{ret: ret, args: rule.Args})
+		}
+	}
+	if len(unknown) > 0 {
+		log.Debug("Seccomp profile: ignoring syscalls that don't exist on this architecture: %s", strings.Join(unknown, ", "))
+	}
+	return byNr, order
+}
+
+// applies evaluates the includes and excludes of a rule. landrun runs the
+// command with its own capabilities, which are usually none.
+func (r OCISyscall) applies(caps map[string]bool, kernel [2]int) bool {
+	if len(r.Includes.Arches) > 0 && !contains(r.Includes.Arches, scmpArch) {
+		return false
+	}
+	for _, c := range r.Includes.Caps {
+		if !caps[c] {
+			return false
+		}
+	}
+	if r.Includes.MinKernel != "" && !kernelAtLeast(kernel, r.Includes.MinKernel) {
+		return false
+	}
+	if contains(r.Excludes.Arches, scmpArch) {
+		return false
+	}
+	for _, c := range r.Excludes.Caps {
+		if caps[c] {
+			return false
+		}
+	}
+	if r.Excludes.MinKernel != "" && kernelAtLeast(kernel, r.Excludes.MinKernel) {
+		return false
+	}
+	return true
+}
+
+// Compile builds the BPF program for the profile. Rules for a syscall are
+// tried in the order of the profile and the first one whose argument
+// comparisons all match decides; syscalls without a matching rule get the
+// default action. As with the built-in policies, syscalls of other
+// architectures kill the process.
+func (p *OCIProfile) Compile() ([]unix.SockFilter, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	def, _ := ociAction(p.DefaultAction, p.DefaultErrnoRet)
+	// x32 syscalls are never allowed since the profile's syscall numbers
+	// don't apply to them.
+	x32 := def
+	if def == unix.SECCOMP_RET_ALLOW || def == unix.SECCOMP_RET_LOG {
+		x32 = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	}
+
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, auditArch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+	}
+	if x32SyscallBit != 0 {
+		prog = append(prog,
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+			jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, x32),
+		)
+	}
+
+	byNr, order := p.rules()
+	for _, nr := range order {
+		// The accumulator is clobbered by argument checks, so every
+		// syscall block reloads the number. Blocks are skipped with an
+		// unconditional jump, whose offset is not limited to 8 bits.
+		prog = append(prog,
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nr, 1, 0),
+		)
+		skip := len(prog)
+		prog = append(prog, stmt(unix.BPF_JMP|unix.BPF_JA, 0))
+		for _, rule := range byNr[nr] {
+			var fails []int
+			for _, arg := range rule.args {
+				block := compileArg(arg)
+				fails = append(fails, len(prog)+len(block)-1)
+				prog = append(prog, block...)
+			}
+			prog = append(prog, stmt(unix.BPF_RET|unix.BPF_K, rule.ret))
+			// Failed comparisons continue with the next rule.
+			for _, f := range fails {
+				prog[f].K = uint32(len(prog) - f - 1)
+			}
+		}
+		prog = append(prog, stmt(unix.BPF_RET|unix.BPF_K, def))
+		prog[skip].K = uint32(len(prog) - skip - 1)
+	}
+	prog = append(prog, stmt(unix.BPF_RET|unix.BPF_K, def))
+	if len(prog) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("seccomp filter too large (%d instructions)", len(prog))
+	}
+	return prog, nil
+}
+
+// Branch targets in the comparison templates of compileArg.
+const (
+	targetNext = iota
+	targetOK
+	targetFail
+)
+
+// compileArg compiles a 64-bit argument comparison into a block that falls
+// through when the comparison holds and ends with a jump, to be patched by
+// the caller, that is taken when it doesn't.
+func compileArg(arg OCIArg) []unix.SockFilter {
+	lo := uint32(offsetArgs + 8*arg.Index)
+	hi := lo + 4
+	v, v2 := arg.Value, arg.ValueTwo
+	vlo, vhi := uint32(v), uint32(v>>32)
+
+	type insn struct {
+		code     uint16
+		k        uint32
+		jt, jf   int
+		isBranch bool
+	}
+	ld := func(off uint32) insn { return insn{code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, k: off} }
+	and := func(mask uint32) insn { return insn{code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, k: mask} }
+	br := func(op uint16, k uint32, jt, jf int) insn {
+		return insn{code: unix.BPF_JMP | op | unix.BPF_K, k: k, jt: jt, jf: jf, isBranch: true}
+	}
+	jeq, jgt, jge := uint16(unix.BPF_JEQ), uint16(unix.BPF_JGT), uint16(unix.BPF_JGE)
+
+	var body []insn
+	switch arg.Op {
+	case "SCMP_CMP_EQ":
+		body = []insn{ld(lo), br(jeq, vlo, targetNext, targetFail), ld(hi), br(jeq, vhi, targetOK, targetFail)}
+	case "SCMP_CMP_NE":
+		body = []insn{ld(lo), br(jeq, vlo, targetNext, targetOK), ld(hi), br(jeq, vhi, targetFail, targetOK)}
+	case "SCMP_CMP_MASKED_EQ":
+		body = []insn{
+			ld(lo), and(uint32(v)), br(jeq, uint32(v2), targetNext, targetFail),
+			ld(hi), and(uint32(v >> 32)), br(jeq, uint32(v2>>32), targetOK, targetFail),
+		}
+	case "SCMP_CMP_GT":
+		body = []insn{ld(hi), br(jgt, vhi, targetOK, targetNext), br(jeq, vhi, targetNext, targetFail), ld(lo), br(jgt, vlo, targetOK, targetFail)}
+	case "SCMP_CMP_GE":
+		body = []insn{ld(hi), br(jgt, vhi, targetOK, targetNext), br(jeq, vhi, targetNext, targetFail), ld(lo), br(jge, vlo, targetOK, targetFail)}
+	case "SCMP_CMP_LT":
+		body = []insn{ld(hi), br(jgt, vhi, targetFail, targetNext), br(jeq, vhi, targetNext, targetOK), ld(lo), br(jge, vlo, targetFail, targetOK)}
+	case "SCMP_CMP_LE":
+		body = []insn{ld(hi), br(jgt, vhi, targetFail, targetNext), br(jeq, vhi, targetNext, targetOK), ld(lo), br(jgt, vlo, targetFail, targetOK)}
+	}
+
+	// The body is followed by "ja 1" (the ok target) skipping "ja fail".
+	okAt, failAt := len(body), len(body)+1
+	offset := func(from, target int) uint8 {
+		switch target {
+		case targetOK:
+			return uint8(okAt - from - 1)
+		case targetFail:
+			return uint8(failAt - from - 1)
+		}
+		return 0
+	}
+	block := make([]unix.SockFilter, 0, len(body)+2)
+	for i, in := range body {
+		f := unix.SockFilter{Code: in.code, K: in.k}
+		if in.isBranch {
+			f.Jt, f.Jf = offset(i, in.jt), offset(i, in.jf)
+		}
+		block = append(block, f)
+	}
+	return append(block,
+		stmt(unix.BPF_JMP|unix.BPF_JA, 1),
+		stmt(unix.BPF_JMP|unix.BPF_JA, 0),
+	)
+}
+
+// effectiveCaps returns the names of the effective capabilities of landrun.
+func effectiveCaps() map[string]bool {
+	caps := map[string]bool{}
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return caps
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			break
+		}
+		for i, name := range capNames {
+			if mask&(1<<uint(i)) != 0 {
+				caps[name] = true
+			}
+		}
+	}
+	return caps
+}
+
+// kernelVersion returns the major and minor version of the running kernel.
+func kernelVersion() [2]int {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return [2]int{}
+	}
+	v, _ := parseKernelVersion(unix.ByteSliceToString(uts.Release[:]))
+	return v
+}
+
+func parseKernelVersion(s string) ([2]int, bool) {
+	var v [2]int
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) < 2 {
+		return v, false
+	}
+	for i := 0; i < 2; i++ {
+		digits := strings.TrimRightFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' })
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func kernelAtLeast(kernel [2]int, min string) bool {
+	want, ok := parseKernelVersion(min)
+	if !ok {
+		return false
+	}
+	return kernel[0] > want[0] || (kernel[0] == want[0] && kernel[1] >= want[1])
+}
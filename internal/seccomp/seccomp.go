@@ -0,0 +1,362 @@
+// Package seccomp compiles syscall policies into seccomp-BPF filters and
+// installs them. It complements Landlock, which doesn't restrict syscalls
+// such as ptrace, mount or bpf that expose kernel attack surface or let a
+// process escape its restrictions.
+package seccomp
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/zouuup/landrun/internal/log"
+	"golang.org/x/sys/unix"
+)
+
+// Policy modes.
+const (
+	// ModeDefault denies the syscalls of DefaultDenyList, plus Deny and
+	// minus Allow.
+	ModeDefault = "default"
+	// ModeDeny denies the syscalls in Deny.
+	ModeDeny = "deny"
+	// ModeAllow denies every syscall except those in Allow.
+	ModeAllow = "allow"
+)
+
+// Actions taken on denied syscalls.
+const (
+	// ActionErrno makes denied syscalls fail with EPERM.
+	ActionErrno = "errno"
+	// ActionKill kills the process making a denied syscall with SIGSYS.
+	ActionKill = "kill"
+)
+
+// seccompSetModeFilter is SECCOMP_SET_MODE_FILTER, the seccomp(2) operation
+// installing a BPF filter.
+const seccompSetModeFilter = 1
+
+// Offsets of the fields of struct seccomp_data.
+const (
+	offsetNr   = 0
+	offsetArch = 4
+)
+
+// DefaultDenyList is the set of syscalls denied by the default policy. None of
+// them are needed by ordinary programs, and Landlock restricts none of them.
+var DefaultDenyList = []string{
+	// Tracing and reading the memory of other processes.
+	"ptrace", "process_vm_readv", "process_vm_writev", "pidfd_getfd",
+	// Kernel keyrings.
+	"keyctl", "add_key", "request_key",
+	// eBPF and performance monitoring.
+	"bpf", "perf_event_open",
+	// io_uring operations are not subject to seccomp filters.
+	"io_uring_setup", "io_uring_enter", "io_uring_register",
+	// userfaultfd is a common building block of kernel exploits.
+	"userfaultfd",
+	// Mounts and namespaces.
+	"mount", "umount2", "pivot_root", "chroot", "unshare", "setns",
+	"fsopen", "fsconfig", "fsmount", "fspick", "move_mount", "open_tree", "mount_setattr",
+	// File handles bypass path based access checks.
+	"open_by_handle_at",
+	// Kernel modules, reboot, swap and system administration.
+	"init_module", "finit_module", "delete_module", "kexec_load", "kexec_file_load",
+	"reboot", "swapon", "swapoff", "acct", "quotactl", "syslog", "vhangup",
+	"settimeofday", "clock_settime", "clock_adjtime", "adjtimex",
+	"iopl", "ioperm",
+}
+
+// Policy describes which syscalls the sandboxed command may use.
+type Policy struct {
+	// Mode is ModeDefault, ModeDeny or ModeAllow, or empty to install no
+	// filter.
+	Mode  string
+	Deny  []string
+	Allow []string
+	// Action is ActionErrno (the default) or ActionKill.
+	Action string
+
+	// ProfilePath is a Docker/OCI seccomp profile, loaded into Profile by
+	// LoadProfile. Its filter is installed in addition to the one of Mode;
+	// the kernel applies the most restrictive result of both.
+	ProfilePath string
+	Profile     *OCIProfile
+
+	// Sockets restricts the sockets the command can create, with a filter
+	// of its own.
+	Sockets SocketFilter
+}
+
+// Enabled reports whether the policy installs a filter.
+func (p Policy) Enabled() bool {
+	return p.Mode != "" || p.Profile != nil || p.Sockets.Enabled()
+}
+
+// LoadProfile loads the OCI profile of the policy, if any. It must be called
+// before the sandbox is enforced, which may prevent reading the file.
+func (p *Policy) LoadProfile() error {
+	if p.ProfilePath == "" || p.Profile != nil {
+		return nil
+	}
+	profile, err := LoadOCIProfile(p.ProfilePath)
+	if err != nil {
+		return err
+	}
+	p.Profile = profile
+	return nil
+}
+
+// Supported reports whether seccomp filters can be built for this
+// architecture.
+func Supported() bool {
+	return auditArch != 0
+}
+
+// ValidateMode checks a --seccomp value.
+func ValidateMode(mode string) error {
+	switch mode {
+	case "", ModeDefault, ModeDeny, ModeAllow:
+		return nil
+	}
+	return fmt.Errorf("invalid seccomp mode %q (expected %s, %s or %s)", mode, ModeDefault, ModeDeny, ModeAllow)
+}
+
+// ValidateAction checks a --seccomp-action value.
+func ValidateAction(action string) error {
+	switch action {
+	case "", ActionErrno, ActionKill:
+		return nil
+	}
+	return fmt.Errorf("invalid seccomp action %q (expected %s or %s)", action, ActionErrno, ActionKill)
+}
+
+// Validate checks the policy and the syscall names in it.
+func (p Policy) Validate() error {
+	if err := ValidateMode(p.Mode); err != nil {
+		return err
+	}
+	if err := ValidateAction(p.Action); err != nil {
+		return err
+	}
+	if p.Profile != nil {
+		if err := p.Profile.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", p.ProfilePath, err)
+		}
+	}
+	if err := p.Sockets.Validate(); err != nil {
+		return err
+	}
+	if p.Sockets.Enabled() && !Supported() {
+		return fmt.Errorf("seccomp filters are not supported on %s", runtime.GOARCH)
+	}
+	if p.Mode == "" {
+		if len(p.Deny) > 0 || len(p.Allow) > 0 {
+			return fmt.Errorf("syscall lists given without a seccomp mode")
+		}
+		return nil
+	}
+	if !Supported() {
+		return fmt.Errorf("seccomp filters are not supported on %s", runtime.GOARCH)
+	}
+	switch {
+	case p.Mode == ModeDeny && len(p.Allow) > 0:
+		return fmt.Errorf("an allow list cannot be used in %s mode", ModeDeny)
+	case p.Mode == ModeAllow && len(p.Deny) > 0:
+		return fmt.Errorf("a deny list cannot be used in %s mode", ModeAllow)
+	}
+	for _, name := range append(append([]string{}, p.Deny...), p.Allow...) {
+		if _, ok := syscallNumbers[name]; !ok {
+			return fmt.Errorf("unknown syscall %q on %s", name, runtime.GOARCH)
+		}
+	}
+	if p.Mode == ModeAllow && !contains(p.Allow, "execve") {
+		return fmt.Errorf("the allow list must include execve, which landrun uses to start the command")
+	}
+	return nil
+}
+
+// Syscalls returns the syscalls the policy lists: the denied ones in the
+// default and deny modes, the allowed ones in allow mode. Syscalls of the
+// default list that don't exist on this architecture are left out.
+func (p Policy) Syscalls() []string {
+	var names []string
+	switch p.Mode {
+	case ModeDefault:
+		for _, name := range append(append([]string{}, DefaultDenyList...), p.Deny...) {
+			if _, ok := syscallNumbers[name]; ok && !contains(p.Allow, name) {
+				names = append(names, name)
+			}
+		}
+	case ModeDeny:
+		names = append(names, p.Deny...)
+	case ModeAllow:
+		names = append(names, p.Allow...)
+	}
+	sort.Strings(names)
+	return dedupe(names)
+}
+
+// action returns the filter return value for denied syscalls.
+func (p Policy) action() uint32 {
+	if p.Action == ActionKill {
+		return unix.SECCOMP_RET_KILL_PROCESS
+	}
+	return unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+}
+
+// Compile builds the BPF program for the policy. The program kills the
+// process on syscalls made for another architecture, such as 32-bit
+// syscalls on x86-64, and denies x32 syscalls, since their numbers differ
+// from the ones the filter checks.
+func (p Policy) Compile() ([]unix.SockFilter, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	match, other := p.action(), uint32(unix.SECCOMP_RET_ALLOW)
+	if p.Mode == ModeAllow {
+		match, other = other, match
+	}
+
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, auditArch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+	}
+	if x32SyscallBit != 0 {
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, p.action()),
+		)
+	}
+	// Each syscall gets a comparison and a return so that no jump exceeds
+	// the 8-bit offsets of BPF.
+	for _, name := range p.Syscalls() {
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, syscallNumbers[name], 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, match),
+		)
+	}
+	prog = append(prog, stmt(unix.BPF_RET|unix.BPF_K, other))
+	if len(prog) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("seccomp filter too large (%d instructions)", len(prog))
+	}
+	return prog, nil
+}
+
+// Install compiles the policy and installs its filters on all threads of the
+// current process. The filters are inherited by the command landrun executes
+// and cannot be removed.
+func Install(p Policy) error {
+	if p.Profile != nil {
+		prog, err := p.Profile.Compile()
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.ProfilePath, err)
+		}
+		if err := installFilter(prog); err != nil {
+			return err
+		}
+		log.Debug("Seccomp filter installed from %s (%d instructions)", p.ProfilePath, len(prog))
+	}
+	if p.Sockets.Enabled() {
+		prog, err := p.Sockets.Compile()
+		if err != nil {
+			return err
+		}
+		if err := installFilter(prog); err != nil {
+			return err
+		}
+		log.Debug("Socket filter installed (%s)", p.Sockets)
+	}
+	if p.Mode == "" {
+		return nil
+	}
+	prog, err := p.Compile()
+	if err != nil {
+		return err
+	}
+	if err := installFilter(prog); err != nil {
+		return err
+	}
+	log.Debug("Seccomp filter installed (%s mode, %d syscalls, %d instructions)", p.Mode, len(p.Syscalls()), len(prog))
+	return nil
+}
+
+// installFilter installs a BPF program on all threads.
+func installFilter(prog []unix.SockFilter) error {
+	// no_new_privs must be set on the thread installing the filter; TSYNC
+	// then applies both to the other threads.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %w", err)
+	}
+	fprog := unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	r, _, errno := unix.RawSyscall(unix.SYS_SECCOMP, seccompSetModeFilter, unix.SECCOMP_FILTER_FLAG_TSYNC, uintptr(unsafe.Pointer(&fprog)))
+	if errno != 0 {
+		return fmt.Errorf("seccomp(SECCOMP_SET_MODE_FILTER): %w", errno)
+	}
+	if r != 0 {
+		return fmt.Errorf("seccomp(SECCOMP_SET_MODE_FILTER): thread %d could not be synchronized", r)
+	}
+	return nil
+}
+
+// WriteText writes a human readable description of the policy.
+func (p Policy) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Seccomp:")
+	if !p.Enabled() {
+		fmt.Fprintln(w, "  disabled")
+		return
+	}
+	if p.Profile != nil {
+		fmt.Fprintf(w, "  profile %s (default action %s, %d rules)\n", p.ProfilePath, p.Profile.DefaultAction, len(p.Profile.Syscalls))
+	}
+	if p.Sockets.Enabled() {
+		fmt.Fprintf(w, "  sockets: %s\n", p.Sockets)
+	}
+	if p.Mode == "" {
+		return
+	}
+	action := "fail with EPERM"
+	if p.Action == ActionKill {
+		action = "kill the process"
+	}
+	if p.Mode == ModeAllow {
+		fmt.Fprintf(w, "  allowed (others %s): %s\n", action, strings.Join(p.Syscalls(), ", "))
+	} else {
+		fmt.Fprintf(w, "  denied (%s): %s\n", action, strings.Join(p.Syscalls(), ", "))
+	}
+}
+
+func stmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupe removes adjacent duplicates from a sorted list.
+func dedupe(sorted []string) []string {
+	out := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,290 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// run evaluates a compiled filter on a syscall, supporting the instructions
+// the compilers emit.
+func run(t *testing.T, prog []unix.SockFilter, arch, nr uint32, args ...uint64) uint32 {
+	t.Helper()
+	var data [offsetArgs + 6*8]byte
+	binary.LittleEndian.PutUint32(data[offsetNr:], nr)
+	binary.LittleEndian.PutUint32(data[offsetArch:], arch)
+	for i, arg := range args {
+		binary.LittleEndian.PutUint64(data[offsetArgs+8*i:], arg)
+	}
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			if ins.K%4 != 0 || int(ins.K) >= len(data) {
+				t.Fatalf("load from unexpected offset %d", ins.K)
+			}
+			acc = binary.LittleEndian.Uint32(data[ins.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			acc &= ins.K
+		case unix.BPF_JMP | unix.BPF_JA:
+			pc += int(ins.K)
+		case unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K:
+			if acc > ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			if acc == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			if acc >= ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			t.Fatalf("unexpected instruction %#x", ins.Code)
+		}
+	}
+	t.Fatalf("filter fell through")
+	return 0
+}
+
+func TestCompile(t *testing.T) {
+	if !Supported() {
+		t.Skip("seccomp filters are not supported on this architecture")
+	}
+	eperm := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	allow := uint32(unix.SECCOMP_RET_ALLOW)
+	kill := uint32(unix.SECCOMP_RET_KILL_PROCESS)
+
+	p := Policy{Mode: ModeDefault, Deny: []string{"chmod"}, Allow: []string{"ptrace"}}
+	prog, err := p.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	cases := map[string]uint32{"bpf": eperm, "mount": eperm, "chmod": eperm, "ptrace": allow, "read": allow, "execve": allow}
+	for name, want := range cases {
+		if got := run(t, prog, auditArch, syscallNumbers[name]); got != want {
+			t.Errorf("default mode, %s: got %#x, want %#x", name, got, want)
+		}
+	}
+	if got := run(t, prog, 0x40000003, syscallNumbers["read"]); got != kill {
+		t.Errorf("foreign architecture: got %#x, want kill", got)
+	}
+	if x32SyscallBit != 0 {
+		if got := run(t, prog, auditArch, x32SyscallBit|syscallNumbers["read"]); got != eperm {
+			t.Errorf("x32 syscall: got %#x, want EPERM", got)
+		}
+	}
+
+	p = Policy{Mode: ModeAllow, Allow: []string{"execve", "read", "exit_group"}, Action: ActionKill}
+	if prog, err = p.Compile(); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	cases = map[string]uint32{"read": allow, "exit_group": allow, "write": kill, "openat": kill}
+	for name, want := range cases {
+		if got := run(t, prog, auditArch, syscallNumbers[name]); got != want {
+			t.Errorf("allow mode, %s: got %#x, want %#x", name, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if !Supported() {
+		t.Skip("seccomp filters are not supported on this architecture")
+	}
+	cases := []struct {
+		policy Policy
+		want   string
+	}{
+		{Policy{Mode: "strict"}, `invalid seccomp mode "strict"`},
+		{Policy{Mode: ModeDefault, Action: "trap"}, `invalid seccomp action "trap"`},
+		{Policy{Deny: []string{"ptrace"}}, "without a seccomp mode"},
+		{Policy{Mode: ModeDeny, Deny: []string{"ptarce"}}, `unknown syscall "ptarce"`},
+		{Policy{Mode: ModeDeny, Allow: []string{"read"}}, "allow list cannot be used"},
+		{Policy{Mode: ModeAllow, Allow: []string{"read"}}, "must include execve"},
+	}
+	for _, tc := range cases {
+		err := tc.policy.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: expected error containing %q, got %v", tc.policy, tc.want, err)
+		}
+	}
+	if err := (Policy{}).Validate(); err != nil {
+		t.Errorf("empty policy: %v", err)
+	}
+}
+
+const testProfile = `{
+	"defaultAction": "SCMP_ACT_ERRNO",
+	"defaultErrnoRet": 38,
+	"architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_X86", "SCMP_ARCH_X32"],
+	"archMap": [{"architecture": "SCMP_ARCH_AARCH64", "subArchitectures": ["SCMP_ARCH_ARM"]}],
+	"syscalls": [
+		{"names": ["read", "write", "no_such_syscall"], "action": "SCMP_ACT_ALLOW"},
+		{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 8, "op": "SCMP_CMP_EQ"}]},
+		{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 4294967295, "op": "SCMP_CMP_EQ"}]},
+		{"names": ["clone"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 2114060288, "valueTwo": 0, "op": "SCMP_CMP_MASKED_EQ"}]},
+		{"names": ["dup3"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 1, "value": 10, "op": "SCMP_CMP_GE"}, {"index": 1, "value": 4294967296, "op": "SCMP_CMP_LT"}]},
+		{"names": ["close"], "action": "SCMP_ACT_KILL_PROCESS", "args": [{"index": 0, "value": 2, "op": "SCMP_CMP_LE"}]},
+		{"names": ["close"], "action": "SCMP_ACT_ALLOW"},
+		{"names": ["mount"], "action": "SCMP_ACT_ALLOW", "includes": {"caps": ["CAP_SYS_ADMIN"]}},
+		{"names": ["bpf"], "action": "SCMP_ACT_ALLOW", "includes": {"minKernel": "99.0"}},
+		{"names": ["getpid"], "action": "SCMP_ACT_ALLOW", "excludes": {"arches": ["SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"]}}
+	]
+}`
+
+func TestOCIProfile(t *testing.T) {
+	if !Supported() {
+		t.Skip("seccomp filters are not supported on this architecture")
+	}
+	path := filepath.Join(t.TempDir(), "profile.json")
+	if err := os.WriteFile(path, []byte(testProfile), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	p, err := LoadOCIProfile(path)
+	if err != nil {
+		t.Fatalf("LoadOCIProfile failed: %v", err)
+	}
+	prog, err := p.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	allow := uint32(unix.SECCOMP_RET_ALLOW)
+	enosys := uint32(unix.SECCOMP_RET_ERRNO | 38)
+	kill := uint32(unix.SECCOMP_RET_KILL_PROCESS)
+	mountAllowed := effectiveCaps()["CAP_SYS_ADMIN"]
+	cases := []struct {
+		name string
+		args []uint64
+		want uint32
+	}{
+		{"read", nil, allow},
+		{"openat", nil, enosys},
+		{"personality", []uint64{8}, allow},
+		{"personality", []uint64{0xffffffff}, allow},
+		{"personality", []uint64{0x1_00000008}, enosys},
+		{"personality", []uint64{0}, enosys},
+		{"clone", []uint64{0x11}, allow},
+		{"clone", []uint64{0x10000000}, enosys},
+		{"dup3", []uint64{0, 10}, allow},
+		{"dup3", []uint64{0, 9}, enosys},
+		{"dup3", []uint64{0, 1 << 32}, enosys},
+		{"close", []uint64{1}, kill},
+		{"close", []uint64{3}, allow},
+		{"bpf", nil, enosys},
+		{"getpid", nil, enosys},
+	}
+	if !mountAllowed {
+		cases = append(cases, struct {
+			name string
+			args []uint64
+			want uint32
+		}{"mount", nil, enosys})
+	}
+	for _, tc := range cases {
+		if got := run(t, prog, auditArch, syscallNumbers[tc.name], tc.args...); got != tc.want {
+			t.Errorf("%s%v: got %#x, want %#x", tc.name, tc.args, got, tc.want)
+		}
+	}
+	if x32SyscallBit != 0 {
+		if got := run(t, prog, auditArch, x32SyscallBit|syscallNumbers["read"]); got != enosys {
+			t.Errorf("x32 syscall: got %#x, want the default action", got)
+		}
+	}
+}
+
+func TestOCIProfileErrors(t *testing.T) {
+	if !Supported() {
+		t.Skip("seccomp filters are not supported on this architecture")
+	}
+	cases := map[string]string{
+		`{"syscalls": []}`:                     "missing defaultAction",
+		`{"defaultAction": "SCMP_ACT_NOTIFY"}`: `unsupported action "SCMP_ACT_NOTIFY"`,
+		`{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_PPC64LE"]}`:                                                                      "does not apply to",
+		`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"action": "SCMP_ACT_ERRNO"}]}`:                                                                  "syscalls[0]: no syscall names",
+		`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ERRNO", "args": [{"index": 6, "op": "SCMP_CMP_EQ"}]}]}`:  "argument index 6 out of range",
+		`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ERRNO", "args": [{"index": 0, "op": "SCMP_CMP_XOR"}]}]}`: `unsupported operator "SCMP_CMP_XOR"`,
+	}
+	for doc, want := range cases {
+		var p OCIProfile
+		if err := json.Unmarshal([]byte(doc), &p); err != nil {
+			t.Fatalf("%s: %v", doc, err)
+		}
+		if err := p.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", doc, want, err)
+		}
+	}
+}
+
+func TestSocketFilter(t *testing.T) {
+	if !Supported() {
+		t.Skip("seccomp filters are not supported on this architecture")
+	}
+	allow := uint32(unix.SECCOMP_RET_ALLOW)
+	noFamily := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EAFNOSUPPORT))
+	noUDP := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPROTONOSUPPORT))
+	eperm := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	socket, socketpair := syscallNumbers["socket"], syscallNumbers["socketpair"]
+
+	cases := []struct {
+		filter SocketFilter
+		nr     uint32
+		args   []uint64
+		want   uint32
+	}{
+		{SocketFilter{Deny: []string{"inet6", "netlink"}}, socket, []uint64{unix.AF_INET6, unix.SOCK_STREAM}, noFamily},
+		{SocketFilter{Deny: []string{"inet6", "netlink"}}, socket, []uint64{unix.AF_NETLINK, unix.SOCK_RAW}, noFamily},
+		{SocketFilter{Deny: []string{"inet6", "netlink"}}, socket, []uint64{unix.AF_INET, unix.SOCK_STREAM}, allow},
+		{SocketFilter{Deny: []string{"unix"}}, socketpair, []uint64{unix.AF_UNIX, unix.SOCK_STREAM}, noFamily},
+		{SocketFilter{Allow: []string{"unix", "inet"}}, socket, []uint64{unix.AF_INET, unix.SOCK_DGRAM}, allow},
+		{SocketFilter{Allow: []string{"unix", "inet"}}, socket, []uint64{unix.AF_UNIX, unix.SOCK_STREAM}, allow},
+		{SocketFilter{Allow: []string{"unix", "inet"}}, socket, []uint64{unix.AF_PACKET, unix.SOCK_RAW}, noFamily},
+		{SocketFilter{Allow: []string{"unix", "inet"}}, socket, []uint64{1<<32 | unix.AF_INET, unix.SOCK_STREAM}, allow},
+		{SocketFilter{NoUDP: true}, socket, []uint64{unix.AF_INET, unix.SOCK_DGRAM | unix.SOCK_CLOEXEC}, noUDP},
+		{SocketFilter{NoUDP: true}, socket, []uint64{unix.AF_INET6, unix.SOCK_DGRAM}, noUDP},
+		{SocketFilter{NoUDP: true}, socket, []uint64{unix.AF_INET6, unix.SOCK_STREAM}, allow},
+		{SocketFilter{NoUDP: true}, socket, []uint64{unix.AF_UNIX, unix.SOCK_DGRAM}, allow},
+		{SocketFilter{Allow: []string{"inet"}, NoUDP: true}, socket, []uint64{unix.AF_INET, unix.SOCK_DGRAM}, noUDP},
+		{SocketFilter{NoUDP: true}, syscallNumbers["io_uring_setup"], nil, eperm},
+		{SocketFilter{Deny: []string{"inet"}}, syscallNumbers["connect"], []uint64{unix.AF_INET}, allow},
+	}
+	for _, tc := range cases {
+		prog, err := tc.filter.Compile()
+		if err != nil {
+			t.Fatalf("%+v: Compile failed: %v", tc.filter, err)
+		}
+		if got := run(t, prog, auditArch, tc.nr, tc.args...); got != tc.want {
+			t.Errorf("%+v: syscall %d%v: got %#x, want %#x", tc.filter, tc.nr, tc.args, got, tc.want)
+		}
+	}
+
+	if _, err := (SocketFilter{Allow: []string{"unix"}, Deny: []string{"inet"}}).Compile(); err == nil {
+		t.Error("expected an error for a filter both allowing and denying families")
+	}
+}
+
+func TestParseSocketFamily(t *testing.T) {
+	for name, want := range map[string]string{"inet6": "inet6", "AF_INET6": "inet6", "ipv4": "inet", "Local": "unix"} {
+		if got, err := ParseSocketFamily(name); err != nil || got != want {
+			t.Errorf("ParseSocketFamily(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseSocketFamily("carrier-pigeon"); err == nil || !strings.Contains(err.Error(), "unknown socket family") {
+		t.Errorf("expected an unknown family error, got %v", err)
+	}
+}
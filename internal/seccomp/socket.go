@@ -0,0 +1,203 @@
+package seccomp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketFamilies maps the names accepted for socket address families to
+// their AF_* numbers.
+var socketFamilies = map[string]uint32{
+	"unix":       unix.AF_UNIX,
+	"inet":       unix.AF_INET,
+	"inet6":      unix.AF_INET6,
+	"netlink":    unix.AF_NETLINK,
+	"packet":     unix.AF_PACKET,
+	"vsock":      unix.AF_VSOCK,
+	"bluetooth":  unix.AF_BLUETOOTH,
+	"can":        unix.AF_CAN,
+	"alg":        unix.AF_ALG,
+	"xdp":        unix.AF_XDP,
+	"key":        unix.AF_KEY,
+	"tipc":       unix.AF_TIPC,
+	"rds":        unix.AF_RDS,
+	"llc":        unix.AF_LLC,
+	"nfc":        unix.AF_NFC,
+	"qipcrtr":    unix.AF_QIPCRTR,
+	"smc":        unix.AF_SMC,
+	"kcm":        unix.AF_KCM,
+	"mctp":       unix.AF_MCTP,
+	"rxrpc":      unix.AF_RXRPC,
+	"phonet":     unix.AF_PHONET,
+	"ieee802154": unix.AF_IEEE802154,
+	"caif":       unix.AF_CAIF,
+	"isdn":       unix.AF_ISDN,
+	"pppox":      unix.AF_PPPOX,
+	"atmpvc":     unix.AF_ATMPVC,
+	"atmsvc":     unix.AF_ATMSVC,
+	"ax25":       unix.AF_AX25,
+	"netrom":     unix.AF_NETROM,
+	"rose":       unix.AF_ROSE,
+	"x25":        unix.AF_X25,
+	"appletalk":  unix.AF_APPLETALK,
+	"ipx":        unix.AF_IPX,
+}
+
+// socketFamilyAliases are alternative names of some families.
+var socketFamilyAliases = map[string]string{
+	"local": "unix",
+	"ipv4":  "inet",
+	"ipv6":  "inet6",
+}
+
+// SocketFamilies returns the names of the supported socket address families.
+func SocketFamilies() []string {
+	names := make([]string, 0, len(socketFamilies))
+	for name := range socketFamilies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseSocketFamily returns the canonical name of a socket address family,
+// given as "inet6", "AF_INET6" or an alias such as "ipv6".
+func ParseSocketFamily(name string) (string, error) {
+	canonical := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "af_")
+	if alias, ok := socketFamilyAliases[canonical]; ok {
+		canonical = alias
+	}
+	if _, ok := socketFamilies[canonical]; !ok {
+		return "", fmt.Errorf("unknown socket family %q (expected one of %s)", name, strings.Join(SocketFamilies(), ", "))
+	}
+	return canonical, nil
+}
+
+// SocketFilter restricts the sockets the command can create, which Landlock
+// doesn't: it only controls TCP bind and connect.
+type SocketFilter struct {
+	// Allow, if not empty, lists the only address families sockets may be
+	// created for.
+	Allow []string
+	// Deny lists address families sockets may not be created for.
+	Deny []string
+	// NoUDP denies datagram sockets of the inet and inet6 families.
+	NoUDP bool
+}
+
+// Enabled reports whether the filter restricts anything.
+func (f SocketFilter) Enabled() bool {
+	return len(f.Allow) > 0 || len(f.Deny) > 0 || f.NoUDP
+}
+
+// Validate checks the family names of the filter.
+func (f SocketFilter) Validate() error {
+	if len(f.Allow) > 0 && len(f.Deny) > 0 {
+		return fmt.Errorf("socket families cannot be both allowed and denied")
+	}
+	for _, name := range append(append([]string{}, f.Allow...), f.Deny...) {
+		if _, err := ParseSocketFamily(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// families returns the AF_* numbers of names, sorted and without duplicates.
+func families(names []string) []uint32 {
+	var nums []uint32
+	for _, name := range names {
+		canonical, _ := ParseSocketFamily(name)
+		nums = append(nums, socketFamilies[canonical])
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	out := nums[:0]
+	for i, n := range nums {
+		if i == 0 || n != nums[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Compile builds the BPF program for the filter. socket(2) and socketpair(2)
+// fail with EAFNOSUPPORT for denied families, and with EPROTONOSUPPORT for
+// UDP sockets if NoUDP is set. io_uring_setup is denied as well, since
+// io_uring can create sockets without going through the filter.
+func (f SocketFilter) Compile() ([]unix.SockFilter, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	denyFamily := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EAFNOSUPPORT))
+	denyUDP := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPROTONOSUPPORT))
+	eperm := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	allow := uint32(unix.SECCOMP_RET_ALLOW)
+
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, auditArch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+	}
+	if x32SyscallBit != 0 {
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, eperm),
+		)
+	}
+	prog = append(prog,
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, syscallNumbers["io_uring_setup"], 0, 1),
+		stmt(unix.BPF_RET|unix.BPF_K, eperm),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, syscallNumbers["socket"], 2, 0),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, syscallNumbers["socketpair"], 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, allow),
+		// The family is an int: only the low word of the argument counts.
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArgs),
+	)
+
+	for _, fam := range families(f.Deny) {
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, fam, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, denyFamily),
+		)
+	}
+	allowed := families(f.Allow)
+	for i, fam := range allowed {
+		// Allowed families skip the remaining comparisons and the return.
+		prog = append(prog, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, fam, uint8(len(allowed)-i), 0))
+	}
+	if len(allowed) > 0 {
+		prog = append(prog, stmt(unix.BPF_RET|unix.BPF_K, denyFamily))
+	}
+
+	if f.NoUDP {
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.AF_INET, 1, 0),
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.AF_INET6, 0, 4),
+			// The type may carry SOCK_NONBLOCK and SOCK_CLOEXEC.
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArgs+8),
+			stmt(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, 0xf),
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.SOCK_DGRAM, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, denyUDP),
+		)
+	}
+	return append(prog, stmt(unix.BPF_RET|unix.BPF_K, allow)), nil
+}
+
+// String describes the filter.
+func (f SocketFilter) String() string {
+	var parts []string
+	if len(f.Allow) > 0 {
+		parts = append(parts, "only "+strings.Join(f.Allow, ", "))
+	}
+	if len(f.Deny) > 0 {
+		parts = append(parts, "no "+strings.Join(f.Deny, ", "))
+	}
+	if f.NoUDP {
+		parts = append(parts, "no UDP")
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,13 @@
+//go:build !amd64 && !arm64
+
+package seccomp
+
+// auditArch is zero on architectures landrun has no syscall table for, which
+// makes Supported return false.
+const auditArch = 0
+
+const scmpArch = ""
+
+const x32SyscallBit = 0
+
+var syscallNumbers = map[string]uint32{}
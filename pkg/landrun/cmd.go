@@ -0,0 +1,207 @@
+package landrun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	internalexec "github.com/zouuup/landrun/internal/exec"
+	"github.com/zouuup/landrun/internal/log"
+	"github.com/zouuup/landrun/internal/sandbox"
+)
+
+// HelperArg is the argument the sandbox helper is started with, see Cmd.
+const HelperArg = internalexec.HelperArg
+
+// Cmd runs a command in a sandbox in a child process, leaving the calling
+// process unrestricted. Its fields and methods mirror those of os/exec.Cmd.
+//
+// The child is the program itself, re-executed with HelperArg: it applies
+// the sandbox to itself and then executes the command, keeping its process
+// ID. The helper is handled by the init function of this package, so only
+// the init functions of the packages initialized before it run in the
+// helper. Programs with init functions that must not run twice can set
+// Helper to the landrun binary instead.
+type Cmd struct {
+	// Path is the command to run. Args holds the command line arguments,
+	// including the command as Args[0].
+	Path string
+	Args []string
+
+	// Env is the environment of the command; if nil, it uses the
+	// environment of the current process.
+	Env []string
+	// Dir is the working directory of the command; if empty, it runs in
+	// the working directory of the current process.
+	Dir string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	SysProcAttr *syscall.SysProcAttr
+
+	// Helper is the executable applying the sandbox in the child; it
+	// defaults to the running program.
+	Helper string
+
+	// Process and ProcessState are set once the command has started and
+	// exited.
+	Process      *os.Process
+	ProcessState *os.ProcessState
+
+	cfg     *Config
+	helper  *internalexec.Helper
+	lookErr error
+}
+
+// Command returns a Cmd running name with args in the sandbox of cfg. As
+// with exec.Command, name is looked up in PATH if it contains no slash. The
+// sandbox must allow executing it.
+func Command(cfg *Config, name string, args ...string) *Cmd {
+	return CommandContext(context.Background(), cfg, name, args...)
+}
+
+// CommandContext is like Command but kills the command if ctx is done
+// before it exits.
+func CommandContext(ctx context.Context, cfg *Config, name string, args ...string) *Cmd {
+	c := &Cmd{
+		Path:   name,
+		Args:   append([]string{name}, args...),
+		cfg:    cfg,
+		helper: internalexec.NewHelper(ctx),
+	}
+	if !strings.Contains(name, "/") {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			c.lookErr = err
+		} else {
+			c.Path = path
+		}
+	}
+	return c
+}
+
+// String returns the command line of c.
+func (c *Cmd) String() string {
+	return strings.Join(append([]string{c.Path}, c.Args[1:]...), " ")
+}
+
+// Start starts the command without waiting for it to exit. It fails if the
+// sandbox cannot be applied in the child.
+func (c *Cmd) Start() error {
+	if c.lookErr != nil {
+		return c.lookErr
+	}
+	if c.Process != nil {
+		return errors.New("landrun: already started")
+	}
+	rs, err := sandbox.Plan(c.cfg.cfg)
+	if err != nil {
+		return err
+	}
+
+	cmd := c.helper.Cmd
+	if c.Helper != "" {
+		cmd.Path = c.Helper
+	}
+	cmd.Dir = c.Dir
+	cmd.SysProcAttr = c.SysProcAttr
+	if c.Stdin != nil {
+		cmd.Stdin = c.Stdin
+	}
+	if c.Stdout != nil {
+		cmd.Stdout = c.Stdout
+	}
+	if c.Stderr != nil {
+		cmd.Stderr = c.Stderr
+	}
+	env := c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	// A relative Path is resolved in Dir, where the helper runs.
+	err = c.helper.Start(rs, c.Path, c.Args, env, internalexec.Options{Log: log.Current()})
+	c.Process = cmd.Process
+	if err != nil {
+		c.ProcessState = cmd.ProcessState
+		return err
+	}
+	return nil
+}
+
+// Wait waits for the command to exit. Like exec.Cmd.Wait, it returns an
+// *exec.ExitError if the command exits with a non-zero status.
+func (c *Cmd) Wait() error {
+	if c.Process == nil {
+		return errors.New("landrun: not started")
+	}
+	err := c.helper.Cmd.Wait()
+	c.ProcessState = c.helper.Cmd.ProcessState
+	return err
+}
+
+// Run starts the command and waits for it to exit.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output.
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("landrun: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	err := c.Run()
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its standard output and
+// standard error.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("landrun: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("landrun: Stderr already set")
+	}
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+	err := c.Run()
+	return out.Bytes(), err
+}
+
+// StdinPipe returns a pipe connected to the standard input of the command.
+func (c *Cmd) StdinPipe() (io.WriteCloser, error) {
+	if c.Stdin != nil {
+		return nil, errors.New("landrun: Stdin already set")
+	}
+	return c.helper.Cmd.StdinPipe()
+}
+
+// StdoutPipe returns a pipe connected to the standard output of the command.
+// As with exec.Cmd, reads must complete before calling Wait.
+func (c *Cmd) StdoutPipe() (io.ReadCloser, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("landrun: Stdout already set")
+	}
+	return c.helper.Cmd.StdoutPipe()
+}
+
+// StderrPipe returns a pipe connected to the standard error of the command.
+func (c *Cmd) StderrPipe() (io.ReadCloser, error) {
+	if c.Stderr != nil {
+		return nil, errors.New("landrun: Stderr already set")
+	}
+	return c.helper.Cmd.StderrPipe()
+}
@@ -0,0 +1,120 @@
+package landrun
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig allows running system commands and writing to dir.
+func testConfig(t *testing.T, dir string) *Config {
+	t.Helper()
+	if ABIVersion() < 5 {
+		t.Skip("Landlock ABI 5 is not available")
+	}
+	cfg, err := NewBuilder().
+		ReadOnlyExec("/usr", "/bin", "/lib", "/lib64").
+		ReadWrite(dir).
+		MissingPaths(MissingSkip).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	return cfg
+}
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t, dir)
+
+	cmd := Command(cfg, "sh", "-c", `echo "$GREETING" > "$1/out" && cat /etc/hostname`, "sh", dir)
+	cmd.Env = []string{"GREETING=hello"}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected the command to fail reading /etc/hostname, got %v\n%s", err, stderr.String())
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "out")); err != nil || string(data) != "hello\n" {
+		t.Errorf("unexpected output file: %q, %v", data, err)
+	}
+	// The calling process is not restricted.
+	if _, err := os.ReadDir("/etc"); err != nil {
+		t.Errorf("reading /etc outside the sandbox failed: %v", err)
+	}
+
+	out, err := Command(cfg, "echo", "hello").Output()
+	if err != nil || string(out) != "hello\n" {
+		t.Errorf("Output = %q, %v", out, err)
+	}
+}
+
+func TestCommandPipes(t *testing.T) {
+	cfg := testConfig(t, t.TempDir())
+	cmd := Command(cfg, "tr", "a-z", "A-Z")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	stdin.Write([]byte("sandboxed"))
+	stdin.Close()
+	buf := make([]byte, 64)
+	n, _ := stdout.Read(buf)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if got := string(buf[:n]); got != "SANDBOXED" {
+		t.Errorf("got %q", got)
+	}
+	if !cmd.ProcessState.Success() {
+		t.Errorf("unexpected state %v", cmd.ProcessState)
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	cfg := testConfig(t, t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := CommandContext(ctx, cfg, "sleep", "10").Run()
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Errorf("expected the command to be killed, got %v", err)
+	}
+}
+
+func TestCommandStartErrors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t, filepath.Join(dir, "data"))
+	missing, err := NewBuilder().ReadOnly(filepath.Join(dir, "missing")).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if err := Command(missing, "true").Run(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the missing path to fail Start, got %v", err)
+	}
+
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ntrue\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = Command(cfg, script).Start()
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected executing a file outside the sandbox to fail Start, got %v", err)
+	}
+
+	if err := Command(cfg, "no-such-command-landrun").Start(); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected exec.ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+// Package landrun builds Landlock sandboxes with the same rules as the
+// landrun command, for Go programs that want to inspect the rules or to
+// sandbox themselves.
+//
+// A Config is built with a Builder, which records the options in the order
+// they are given and validates them in Build:
+//
+//	cfg, err := landrun.NewBuilder().
+//		ReadOnlyExec("/usr").
+//		ReadOnly("/etc/ssl").
+//		ReadWrite("$HOME/.cache/myservice").
+//		ConnectTCP(443).
+//		Build()
+//	if err != nil {
+//		return err
+//	}
+//	if err := cfg.RestrictSelf(); err != nil {
+//		return err
+//	}
+//
+// Landlock restrictions apply to all threads of the process and to the
+// processes it starts, and cannot be lifted.
+package landrun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"github.com/zouuup/landrun/internal/elfdeps"
+	internalexec "github.com/zouuup/landrun/internal/exec"
+	"github.com/zouuup/landrun/internal/log"
+	"github.com/zouuup/landrun/internal/pathvars"
+	"github.com/zouuup/landrun/internal/preset"
+	"github.com/zouuup/landrun/internal/profile"
+	"github.com/zouuup/landrun/internal/sandbox"
+)
+
+// Policies for paths that don't exist, see Builder.MissingPaths.
+const (
+	// MissingError makes Plan and RestrictSelf fail on missing paths.
+	MissingError = sandbox.MissingError
+	// MissingWarn skips missing paths with a warning in Rules.Warnings.
+	MissingWarn = sandbox.MissingWarn
+	// MissingSkip skips missing paths silently.
+	MissingSkip = sandbox.MissingSkip
+)
+
+// ErrUnsupported is returned by RestrictSelf when the kernel doesn't support
+// Landlock and best-effort mode is off.
+var ErrUnsupported = errors.New("landlock is not supported by the kernel")
+
+// OptionError reports an invalid option given to a Builder.
+type OptionError struct {
+	// Option is the name of the Builder method, such as "Path".
+	Option string
+	// Value is the offending value.
+	Value string
+	Err   error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("%s(%q): %v", e.Option, e.Value, e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+func init() {
+	// Cmd re-executes the program as a helper, which sandboxes itself and
+	// executes the command.
+	if len(os.Args) > 1 && os.Args[1] == HelperArg {
+		internalexec.RunHelper()
+	}
+	// Only report errors and warnings by default; the landrun command sets
+	// its own level.
+	log.SetLevel("warn")
+}
+
+// SetLogLevel sets the level of the messages landrun writes to stderr:
+// "error", "warn" (the default), "info", "debug" or "trace".
+func SetLogLevel(level string) {
+	log.SetLevel(level)
+}
+
+// ABIVersion returns the Landlock ABI version of the running kernel, or 0 if
+// Landlock is unavailable.
+func ABIVersion() int {
+	v, err := ll.LandlockGetABIVersion()
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// Builder collects sandbox options. Its methods return the builder so that
+// calls can be chained; the first invalid option is reported by Build.
+type Builder struct {
+	p         profile.Profile
+	libraries []string
+	err       error
+}
+
+// NewBuilder returns a builder for a sandbox that grants nothing.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) fail(option, value string, err error) *Builder {
+	if b.err == nil {
+		b.err = &OptionError{Option: option, Value: value, Err: err}
+	}
+	return b
+}
+
+// ReadOnly grants read access to paths, like --ro.
+func (b *Builder) ReadOnly(paths ...string) *Builder {
+	b.p.ReadOnlyPaths = append(b.p.ReadOnlyPaths, paths...)
+	return b
+}
+
+// ReadOnlyExec grants read and execute access to paths, like --rox.
+func (b *Builder) ReadOnlyExec(paths ...string) *Builder {
+	b.p.ReadOnlyExecutablePaths = append(b.p.ReadOnlyExecutablePaths, paths...)
+	return b
+}
+
+// ReadWrite grants read and write access to paths, like --rw.
+func (b *Builder) ReadWrite(paths ...string) *Builder {
+	b.p.ReadWritePaths = append(b.p.ReadWritePaths, paths...)
+	return b
+}
+
+// ReadWriteExec grants read, write and execute access to paths, like --rwx.
+func (b *Builder) ReadWriteExec(paths ...string) *Builder {
+	b.p.ReadWriteExecutablePaths = append(b.p.ReadWriteExecutablePaths, paths...)
+	return b
+}
+
+// Path grants an explicit set of access rights on path, like --path. rights
+// is a comma separated list of Landlock right names such as "read_file" or
+// "make_reg", or of the aliases read, write, exec, ro, rox, rw and rwx.
+func (b *Builder) Path(path, rights string) *Builder {
+	access, err := sandbox.ParseAccessFS(rights)
+	if err != nil {
+		return b.fail("Path", path+":"+rights, err)
+	}
+	b.p.CustomPaths = append(b.p.CustomPaths, sandbox.CustomPath{Path: path, Access: access})
+	return b
+}
+
+// Deny withholds all access to paths inside the granted trees, like --deny.
+func (b *Builder) Deny(paths ...string) *Builder {
+	b.p.DenyPaths = append(b.p.DenyPaths, paths...)
+	return b
+}
+
+// BindTCP allows binding TCP ports.
+func (b *Builder) BindTCP(ports ...int) *Builder {
+	return b.ports("BindTCP", &b.p.BindTCPPorts, ports)
+}
+
+// ConnectTCP allows connecting to TCP ports.
+func (b *Builder) ConnectTCP(ports ...int) *Builder {
+	return b.ports("ConnectTCP", &b.p.ConnectTCPPorts, ports)
+}
+
+func (b *Builder) ports(option string, dst *[]int, ports []int) *Builder {
+	for _, port := range ports {
+		if err := sandbox.ValidatePort(port); err != nil {
+			return b.fail(option, strconv.Itoa(port), err)
+		}
+		*dst = append(*dst, port)
+	}
+	return b
+}
+
+// Preset adds the rules of built-in presets, such as "system-ro". See
+// Presets for the available names.
+func (b *Builder) Preset(names ...string) *Builder {
+	for _, name := range names {
+		if _, err := preset.Get(name); err != nil {
+			return b.fail("Preset", name, err)
+		}
+		b.p.Presets = append(b.p.Presets, name)
+	}
+	return b
+}
+
+// Presets returns the names of the built-in presets.
+func Presets() []string {
+	return preset.Names()
+}
+
+// Var defines a variable that paths can reference as $NAME or ${NAME}.
+// Variables that aren't defined with Var are looked up in the environment;
+// references to undefined variables make Build fail.
+func (b *Builder) Var(name, value string) *Builder {
+	if b.p.Vars == nil {
+		b.p.Vars = map[string]string{}
+	}
+	b.p.Vars[name] = value
+	return b
+}
+
+// Executable grants read and execute access to binary and to the shared
+// libraries it loads, including those declared in .note.dlopen sections,
+// like --add-exec and --ldd. If binary is a script, its #! interpreters and
+// their libraries are included too; #!/usr/bin/env interpreters are looked
+// up in the PATH of the calling process.
+func (b *Builder) Executable(binary string) *Builder {
+	b.p.ReadOnlyExecutablePaths = append(b.p.ReadOnlyExecutablePaths, binary)
+	b.libraries = append(b.libraries, binary)
+	return b
+}
+
+// MissingPaths sets the policy for paths that don't exist: MissingError (the
+// default), MissingWarn or MissingSkip.
+func (b *Builder) MissingPaths(policy string) *Builder {
+	if err := sandbox.ValidateMissingPolicy(policy); err != nil {
+		return b.fail("MissingPaths", policy, err)
+	}
+	b.p.MissingPaths = policy
+	return b
+}
+
+// BestEffort falls back to the restrictions the kernel supports instead of
+// failing on kernels with an older Landlock ABI.
+func (b *Builder) BestEffort() *Builder {
+	return b.flag(&b.p.BestEffort)
+}
+
+// UnrestrictedFilesystem leaves filesystem access unrestricted.
+func (b *Builder) UnrestrictedFilesystem() *Builder {
+	return b.flag(&b.p.UnrestrictedFilesystem)
+}
+
+// UnrestrictedNetwork leaves network access unrestricted.
+func (b *Builder) UnrestrictedNetwork() *Builder {
+	return b.flag(&b.p.UnrestrictedNetwork)
+}
+
+// ScopeAbstractUnix blocks connecting to abstract unix sockets created
+// outside the sandbox (Landlock ABI 6).
+func (b *Builder) ScopeAbstractUnix() *Builder {
+	return b.flag(&b.p.ScopeAbstractUnix)
+}
+
+// ScopeSignal blocks sending signals to processes outside the sandbox
+// (Landlock ABI 6).
+func (b *Builder) ScopeSignal() *Builder {
+	return b.flag(&b.p.ScopeSignal)
+}
+
+func (b *Builder) flag(dst **bool) *Builder {
+	yes := true
+	*dst = &yes
+	return b
+}
+
+// Build validates the options and returns the sandbox configuration. Presets
+// are resolved, variables in paths are expanded and the libraries of
+// executables are looked up. Paths are only checked for existence by Plan
+// and RestrictSelf.
+func (b *Builder) Build() (*Config, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	p, err := preset.Resolve(&b.p)
+	if err != nil {
+		return nil, &OptionError{Option: "Preset", Err: err}
+	}
+	cfg := p.SandboxConfig()
+
+	vars := map[string]string{}
+	for name, value := range p.Vars {
+		vars[name] = value
+	}
+	for name, value := range pathvars.Builtins("") {
+		vars[name] = value
+	}
+	expander := &pathvars.Expander{Vars: vars, Strict: true}
+	if err := cfg.MapPaths(expander.Expand); err != nil {
+		return nil, &OptionError{Option: "Var", Err: err}
+	}
+
+	for _, binary := range b.libraries {
+		deps, err := elfdeps.GetExecutableDependencies(binary, os.Getenv("PATH"), elfdeps.Options{DlopenNotes: true})
+		if err != nil {
+			return nil, &OptionError{Option: "Executable", Value: binary, Err: err}
+		}
+		for _, dep := range deps {
+			cfg.ReadOnlyExecutablePaths = append(cfg.ReadOnlyExecutablePaths, dep.Path)
+		}
+	}
+	return &Config{cfg: cfg}, nil
+}
+
+// Config is a validated sandbox configuration.
+type Config struct {
+	cfg sandbox.Config
+}
+
+// Plan computes the Landlock rules for the configuration without enforcing
+// them. It fails on missing paths unless they are skipped by the missing
+// path policy; such errors match fs.ErrNotExist.
+func (c *Config) Plan() (*Rules, error) {
+	rs, err := sandbox.Plan(c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newRules(rs), nil
+}
+
+// RestrictSelf enforces the configuration on the calling process. Programs
+// typically call it after their initialization, once they have opened the
+// files they need outside the sandbox.
+func (c *Config) RestrictSelf() error {
+	if !c.cfg.BestEffort && ABIVersion() == 0 {
+		return ErrUnsupported
+	}
+	rs, err := sandbox.Plan(c.cfg)
+	if err != nil {
+		return err
+	}
+	return sandbox.Enforce(rs)
+}
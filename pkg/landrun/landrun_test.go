@@ -0,0 +1,132 @@
+package landrun
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildErrors(t *testing.T) {
+	cases := []struct {
+		b      *Builder
+		option string
+	}{
+		{NewBuilder().ReadOnly("/etc").Path("/srv", "read,fly"), "Path"},
+		{NewBuilder().BindTCP(80).ConnectTCP(443, 70000), "ConnectTCP"},
+		{NewBuilder().Preset("no-such-preset"), "Preset"},
+		{NewBuilder().MissingPaths("ignore"), "MissingPaths"},
+		{NewBuilder().ReadOnly("$LANDRUN_TEST_UNDEFINED/data"), "Var"},
+	}
+	for _, tc := range cases {
+		_, err := tc.b.Build()
+		var oe *OptionError
+		if !errors.As(err, &oe) || oe.Option != tc.option {
+			t.Errorf("expected an OptionError for %s, got %v", tc.option, err)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewBuilder().
+		Var("DATA", dir).
+		ReadOnly("$DATA").
+		Path(file, "write_file").
+		ConnectTCP(443).
+		BindTCP(8080).
+		ScopeSignal().
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	rules, err := cfg.Plan()
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if !rules.RestrictFilesystem || !rules.RestrictNetwork {
+		t.Errorf("expected filesystem and network restrictions, got %+v", rules)
+	}
+	paths := map[string]PathRule{}
+	for _, r := range rules.Paths {
+		paths[r.Path] = r
+	}
+	if r := paths[dir]; !r.Dir || !reflect.DeepEqual(r.Access, []string{"read_file", "read_dir"}) {
+		t.Errorf("unexpected rule for %s: %+v", dir, r)
+	}
+	if r := paths[file]; r.Dir || !reflect.DeepEqual(r.Access, []string{"write_file"}) {
+		t.Errorf("unexpected rule for %s: %+v", file, r)
+	}
+	want := []PortRule{{Port: 8080, Bind: true}, {Port: 443, Connect: true}}
+	if !reflect.DeepEqual(rules.Ports, want) {
+		t.Errorf("ports = %+v, want %+v", rules.Ports, want)
+	}
+	if !reflect.DeepEqual(rules.Scopes, []string{"signal"}) {
+		t.Errorf("scopes = %v", rules.Scopes)
+	}
+
+	var out strings.Builder
+	rules.WriteText(&out)
+	if !strings.Contains(out.String(), "tcp/443") {
+		t.Errorf("port missing from output:\n%s", out.String())
+	}
+}
+
+func TestPlanMissingPath(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	cfg, err := NewBuilder().ReadOnly(missing).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if _, err := cfg.Plan(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	cfg, err = NewBuilder().ReadOnly(missing).MissingPaths(MissingWarn).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	rules, err := cfg.Plan()
+	if err != nil || len(rules.Warnings) != 1 {
+		t.Errorf("expected the missing path to be skipped with a warning, got %v, %v", rules, err)
+	}
+}
+
+// TestRestrictSelf sandboxes a copy of the test binary, since restrictions
+// cannot be lifted.
+func TestRestrictSelf(t *testing.T) {
+	if dir := os.Getenv("LANDRUN_TEST_RESTRICT_DIR"); dir != "" {
+		cfg, err := NewBuilder().ReadWrite(dir).Build()
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		if err := cfg.RestrictSelf(); err != nil {
+			t.Fatalf("RestrictSelf failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "allowed"), nil, 0644); err != nil {
+			t.Errorf("write inside the sandbox failed: %v", err)
+		}
+		if _, err := os.ReadDir("/"); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("expected reading / to be denied, got %v", err)
+		}
+		return
+	}
+	if ABIVersion() < 5 {
+		t.Skip("Landlock ABI 5 is not available")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestrictSelf$")
+	cmd.Env = append(os.Environ(), "LANDRUN_TEST_RESTRICT_DIR="+t.TempDir())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("sandboxed test failed: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,84 @@
+package landrun
+
+import (
+	"io"
+
+	"github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"github.com/zouuup/landrun/internal/sandbox"
+)
+
+// Rules are the Landlock rules computed for a Config. Rules for the same
+// path or port are merged.
+type Rules struct {
+	Paths []PathRule
+	Ports []PortRule
+
+	// RestrictFilesystem and RestrictNetwork report whether filesystem and
+	// network access are restricted at all.
+	RestrictFilesystem bool
+	RestrictNetwork    bool
+
+	// Scopes lists the Landlock scopes, "abstract-unix" and "signal".
+	Scopes []string
+
+	// Warnings describe limitations of the rules, such as skipped missing
+	// paths.
+	Warnings []string
+
+	rs *sandbox.Ruleset
+}
+
+// PathRule grants access to a file or directory.
+type PathRule struct {
+	Path string
+	Dir  bool
+	// Access lists the Landlock access rights granted, by their names
+	// without the LANDLOCK_ACCESS_FS_ prefix, such as "read_file".
+	Access []string
+	// Create is set for paths created before the rules are enforced if they
+	// don't exist.
+	Create bool
+}
+
+// PortRule allows binding or connecting to a TCP port.
+type PortRule struct {
+	Port    int
+	Bind    bool
+	Connect bool
+}
+
+func newRules(rs *sandbox.Ruleset) *Rules {
+	r := &Rules{
+		RestrictFilesystem: rs.RestrictFilesystem,
+		RestrictNetwork:    rs.RestrictNetwork,
+		Warnings:           append([]string{}, rs.Warnings...),
+		rs:                 rs,
+	}
+	if rs.ScopeAbstractUnix {
+		r.Scopes = append(r.Scopes, "abstract-unix")
+	}
+	if rs.ScopeSignal {
+		r.Scopes = append(r.Scopes, "signal")
+	}
+	for _, p := range rs.Paths {
+		r.Paths = append(r.Paths, PathRule{
+			Path:   p.Path,
+			Dir:    p.Dir,
+			Access: sandbox.AccessFSNames(p.Access),
+			Create: p.Create,
+		})
+	}
+	for _, p := range rs.Ports {
+		r.Ports = append(r.Ports, PortRule{
+			Port:    p.Port,
+			Bind:    p.Access&syscall.AccessNetBindTCP != 0,
+			Connect: p.Access&syscall.AccessNetConnectTCP != 0,
+		})
+	}
+	return r
+}
+
+// WriteText writes the rules in the format of landrun --dry-run.
+func (r *Rules) WriteText(w io.Writer) {
+	r.rs.WriteText(w)
+}
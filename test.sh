@@ -90,6 +90,8 @@ echo "#!/bin/bash" > "$EXEC_DIR/test.sh"
 echo "echo 'executable content'" >> "$EXEC_DIR/test.sh"
 chmod +x "$EXEC_DIR/test.sh"
 cp $EXEC_DIR/test.sh $EXEC_DIR/test2.sh
+printf '#!/usr/bin/env bash\necho "env script content"\n' > "$EXEC_DIR/env_script.sh"
+chmod +x "$EXEC_DIR/env_script.sh"
 
 cp "$RO_DIR/test.txt" "$RO_DIR_NESTED_RO/test.txt"
 cp "$RO_DIR/test.txt" "$RW_DIR_NESTED_RO/test.txt"
@@ -182,6 +184,22 @@ run_test "Execute a file with --add-exec and --ldd flag" \
     "./landrun --log-level debug --add-exec --ldd -- /usr/bin/true" \
     0
 
+run_test "--ldd adds the dependencies of libraries" \
+    "./landrun --log-level debug --add-exec --ldd -- curl --version" \
+    0
+
+run_test "--ldd-heuristics adds libraries loaded with dlopen" \
+    "./landrun --dry-run --ldd --ldd-heuristics --add-exec -- /usr/bin/true | grep -q 'optional, heuristic'" \
+    0
+
+run_test "--ldd-heuristics requires --ldd" \
+    "./landrun --ldd-heuristics --add-exec -- /usr/bin/true" \
+    1
+
+run_test "--add-exec and --ldd follow #!/usr/bin/env interpreters" \
+    "./landrun --log-level debug --add-exec --ldd -- $EXEC_DIR/env_script.sh" \
+    0
+
 
 run_test "No execute access with just ro flag" \
     "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --ro $EXEC_DIR -- $EXEC_DIR/test.sh" \
@@ -267,6 +285,258 @@ run_test "Passing custom environment variable" \
     "./landrun --log-level debug --rox /usr --ro / --env CUSTOM_VAR=custom_value -- bash -c 'echo \$CUSTOM_VAR | grep \"custom_value\"'" \
     0
 
+run_test "Expanding variables in environment values" \
+    "./landrun --log-level debug --rox /usr --ro / --env 'CUSTOM_VAR=\${TEST_ENV_VAR}_suffix' -- bash -c '[[ \$CUSTOM_VAR == test_value_123_suffix ]]'" \
+    0
+
+printf 'export FILE_VAR="from file"\n# comment\nLITERAL_VAR=\x27$TEST_ENV_VAR\x27\n' > "$TEST_DIR/test.env"
+run_test "Loading an env file" \
+    "./landrun --log-level debug --rox /usr --ro / --env-file $TEST_DIR/test.env -- bash -c '[[ \$FILE_VAR == \"from file\" && \$LITERAL_VAR == \"\\\$TEST_ENV_VAR\" ]]'" \
+    0
+
+run_test "Passing variables matching a pattern" \
+    "./landrun --log-level debug --rox /usr --ro / --env-pattern 'TEST_ENV_*' -- bash -c '[[ \$TEST_ENV_VAR == test_value_123 ]]'" \
+    0
+
+run_test "Unsetting inherited variables" \
+    "./landrun --log-level debug --rox /usr --ro / --inherit-env --unset-env 'TEST_ENV_*' -- bash -c '[[ -z \$TEST_ENV_VAR && -n \$PATH ]]'" \
+    0
+
+run_test "Minimal environment preset" \
+    "./landrun --log-level debug --rox /usr --ro / --env-preset minimal -- bash -c '[[ -n \$PATH && -z \$TEST_ENV_VAR ]]'" \
+    0
+
+run_test "Missing variable fails with --env-strict" \
+    "./landrun --log-level debug --rox /usr --ro / --env-strict --env LANDRUN_UNSET_VAR -- true" \
+    1
+
+# Fine-grained access right tests
+run_test "Create file with make_reg right" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --path $RW_DIR:read,write,make_reg -- touch $RW_DIR/make_reg.txt" \
+    0
+
+run_test "No mkdir without make_dir right" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --path $RW_DIR:read,write,make_reg -- mkdir $RW_DIR/make_dir" \
+    1
+
+run_test "Unknown access right" \
+    "./landrun --log-level debug --rox /usr --path $RW_DIR:read,bogus -- true" \
+    1
+
+# Glob pattern tests
+run_test "Glob pattern in read-only path" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --ro '$RO_DIR/*.txt' -- cat $RO_DIR/test.txt" \
+    0
+
+run_test "Glob pattern matching nothing fails with --fail-empty-glob" \
+    "./landrun --log-level debug --fail-empty-glob --rox /usr --ro '$RO_DIR/*.nothing' -- true" \
+    1
+
+# Variable expansion tests
+run_test "Variable defined with --var in path" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --var DIR=$RO_DIR --ro '\${DIR}' -- cat $RO_DIR/test.txt" \
+    0
+
+run_test "Undefined variable with --strict-vars" \
+    "./landrun --log-level debug --strict-vars --rox /usr --ro '\${LANDRUN_UNDEFINED_VAR}/x' -- true" \
+    1
+
+# Deny tests
+mkdir -p "$RW_DIR/denied"
+echo "secret" > "$RW_DIR/denied/secret.txt"
+echo "visible" > "$RW_DIR/visible.txt"
+
+run_test "Deny path inside allowed directory" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --ro $RW_DIR --deny $RW_DIR/denied -- cat $RW_DIR/denied/secret.txt" \
+    1
+
+run_test "Siblings of denied path remain accessible" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --ro $RW_DIR --deny $RW_DIR/denied -- cat $RW_DIR/visible.txt" \
+    0
+
+# Scoping tests
+run_test "Signal to process outside the sandbox with --scope-signal" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --scope-signal -- kill -0 $$" \
+    1
+
+run_test "Dry run lists scopes" \
+    "./landrun --dry-run --best-effort --scope-signal --scope-abstract-unix -- true | grep -q 'Scopes:'" \
+    0
+
+# Port specification tests
+run_test "Out of range TCP port is rejected" \
+    "./landrun --log-level debug --rox /usr --connect-tcp 70000 -- true" \
+    1
+
+run_test "TCP port range and service name" \
+    "./landrun --dry-run --connect-tcp https --bind-tcp 8000-8002 -- true | grep -q 'tcp/8002'" \
+    0
+
+# Missing path tests
+run_test "Optional missing path is skipped" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --ro ?/nonexistent/path -- true" \
+    0
+
+run_test "Missing paths skipped with --missing-paths=skip" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --ro /nonexistent/path --missing-paths skip -- true" \
+    0
+
+run_test "Missing path created with --rw-create" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --rw-create $RW_DIR/created/sub/:0700 -- touch $RW_DIR/created/sub/file.txt" \
+    0
+
+# Supervisor tests
+run_test "Supervised command exit code is propagated" \
+    "./landrun --log-level debug --supervise --rox /usr --ro /lib --ro /lib64 -- sh -c 'exit 3'" \
+    3
+
+run_test "Supervised command killed by a signal" \
+    "./landrun --log-level debug --supervise --rox /usr --ro /lib --ro /lib64 -- sh -c 'kill -TERM \$\$'" \
+    143
+
+run_test "Supervised command is sandboxed" \
+    "./landrun --log-level debug --supervise --rox /usr --ro /lib --ro /lib64 -- cat $RO_DIR/test.txt" \
+    1
+
+run_test "On-exit command sees the exit code" \
+    "./landrun --log-level debug --supervise --on-exit 'echo \$LANDRUN_EXIT_CODE > $RW_DIR/exit_code' --rox /usr --ro /lib --ro /lib64 -- sh -c 'exit 7'; grep -qx 7 $RW_DIR/exit_code" \
+    0
+
+run_test "Run report records the command and its exit" \
+    "./landrun --log-level debug --supervise --report $TEST_DIR/report.json --env-preset minimal --rox /usr --ro /lib --ro /lib64 -- sh -c 'exit 5'; [ \$? -eq 5 ] && grep -q '\"code\": 5' $TEST_DIR/report.json && grep -q '\"sha256\": \"[0-9a-f]\{64\}\"' $TEST_DIR/report.json && grep -q '\"PATH\"' $TEST_DIR/report.json" \
+    0
+
+run_test "Run report requires --supervise" \
+    "./landrun --log-level debug --report $TEST_DIR/report.json --rox /usr -- true" \
+    1
+
+# Logging tests
+run_test "JSON log messages go to the log file" \
+    "./landrun --log-level trace --log-format json --log-file $TEST_DIR/landrun.log --rox /usr --ro /lib --ro /lib64 -- true 2> $TEST_DIR/stderr.txt && grep -q '\"event\":\"path_rule\",.*\"path\":\"/usr\"' $TEST_DIR/landrun.log && ! [ -s $TEST_DIR/stderr.txt ]" \
+    0
+
+run_test "Supervised helper logs to the log file" \
+    "./landrun --log-level info --log-file $TEST_DIR/supervised.log --supervise --rox /usr --ro /lib --ro /lib64 -- true && grep -q 'Landlock restrictions applied' $TEST_DIR/supervised.log" \
+    0
+
+run_test "Invalid log format is rejected" \
+    "./landrun --log-format xml --rox /usr -- true" \
+    1
+
+# Resource limit tests
+run_test "Open file limit is applied" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --limit-nofile 64 -- sh -c 'test \$(ulimit -n) -eq 64'" \
+    0
+
+run_test "File size limit stops large writes" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --ro /dev/zero --rw $RW_DIR --limit-fsize 1K -- sh -c 'head -c 5000 /dev/zero > $RW_DIR/big'" \
+    153
+
+run_test "Limit above the inherited hard limit is rejected" \
+    "./landrun --log-level debug --rox /usr --limit-nofile unlimited -- true || ulimit -Hn | grep -qv unlimited" \
+    0
+
+# Seccomp tests
+run_test "Default seccomp policy denies unshare" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --seccomp default -- unshare -U true" \
+    1
+
+run_test "Syscall allowed back from the default policy" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --seccomp default --seccomp-allow uname -- uname" \
+    0
+
+run_test "Seccomp kill action" \
+    "./landrun --log-level debug --supervise --rox /usr --ro /lib --ro /lib64 --seccomp deny --seccomp-deny uname --seccomp-action kill -- uname" \
+    159
+
+run_test "Unknown syscall name is rejected" \
+    "./landrun --log-level debug --rox /usr --seccomp deny --seccomp-deny no_such_syscall -- true" \
+    1
+
+run_test "Denied socket family" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --deny-socket-family netlink -- ip link" \
+    1
+
+run_test "Socket family outside the allow list" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --allow-socket-family unix -- bash -c 'echo > /dev/udp/127.0.0.1/9'" \
+    1
+
+run_test "UDP sockets denied with --no-udp" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --no-udp -- bash -c 'echo > /dev/udp/127.0.0.1/9'" \
+    1
+
+run_test "UDP sockets allowed without --no-udp" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 -- bash -c 'echo > /dev/udp/127.0.0.1/9'" \
+    0
+
+run_test "Socket restrictions lifted by --unrestricted-network" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --unrestricted-network --no-udp -- bash -c 'echo > /dev/udp/127.0.0.1/9'" \
+    0
+
+cat > "$TEST_DIR/seccomp.json" <<EOF
+{
+  "defaultAction": "SCMP_ACT_ALLOW",
+  "architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"],
+  "syscalls": [
+    {"names": ["uname"], "action": "SCMP_ACT_ERRNO", "errnoRet": 1},
+    {"names": ["personality"], "action": "SCMP_ACT_ERRNO", "args": [{"index": 0, "value": 8, "op": "SCMP_CMP_EQ"}]}
+  ]
+}
+EOF
+
+run_test "OCI seccomp profile denies uname" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --seccomp-profile $TEST_DIR/seccomp.json -- uname" \
+    1
+
+run_test "OCI seccomp profile allows other syscalls" \
+    "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --seccomp-profile $TEST_DIR/seccomp.json -- ls /usr" \
+    0
+
+echo '{"defaultAction": "SCMP_ACT_NOTIFY"}' > "$TEST_DIR/bad-seccomp.json"
+run_test "Invalid OCI seccomp profile is rejected" \
+    "./landrun --log-level debug --rox /usr --seccomp-profile $TEST_DIR/bad-seccomp.json -- true" \
+    1
+
+# Profile file tests
+cat > "$TEST_DIR/profile.toml" <<EOF
+rox = ["/usr"]
+ro = ["/lib", "/lib64", "$RO_DIR"]
+EOF
+
+run_test "Read-only access from profile file" \
+    "./landrun --log-level debug --profile $TEST_DIR/profile.toml -- cat $RO_DIR/test.txt" \
+    0
+
+run_test "Flags merged on top of profile file" \
+    "./landrun --log-level debug --profile $TEST_DIR/profile.toml --rw $RW_DIR -- touch $RW_DIR/from_profile.txt" \
+    0
+
+run_test "Profile file does not grant write access" \
+    "./landrun --log-level debug --profile $TEST_DIR/profile.toml -- touch $RO_DIR/from_profile.txt" \
+    1
+
+# Preset tests
+run_test "System preset allows running system commands" \
+    "./landrun --log-level debug --preset system-ro -- ls /usr" \
+    0
+
+run_test "Preset combined with flags" \
+    "./landrun --log-level debug --preset system-ro --rw $RW_DIR -- touch $RW_DIR/from_preset.txt" \
+    0
+
+run_test "Unknown preset" \
+    "./landrun --log-level debug --preset no-such-preset -- true" \
+    1
+
+# Dry-run tests
+run_test "Dry run prints rules" \
+    "./landrun --dry-run --rox /usr --ro $RO_DIR -- cat $RO_DIR/test.txt | grep -q 'from:   --ro'" \
+    0
+
+run_test "Dry run does not execute the command" \
+    "./landrun --dry-run --rox /usr --rw $RW_DIR -- touch $RW_DIR/dry_run.txt && [ ! -e $RW_DIR/dry_run.txt ]" \
+    0
+
 # Combining different permission types
 run_test "Mixed permissions" \
     "./landrun --log-level debug --rox /usr --ro /lib --ro /lib64 --rox $EXEC_DIR --rwx $RW_DIR -- bash -c '$EXEC_DIR/test.sh > $RW_DIR/output.txt && cat $RW_DIR/output.txt'" \